@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/netdata/statsd"
+)
+
+// statusCodeReporter is a compatible `http.ResponseWriter` which stores the `statusCode` for further reporting.
+type statusCodeReporter struct {
+	http.ResponseWriter
+	written    bool
+	statusCode int
+}
+
+func (w *statusCodeReporter) WriteHeader(statusCode int) {
+	if w.written {
+		return
+	}
+
+	w.statusCode = statusCode
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *statusCodeReporter) Write(b []byte) (int, error) {
+	w.written = true
+	return w.ResponseWriter.Write(b)
+}
+
+func main() {
+	// Graphite tags are written as part of the metric name, i.e "hub.index.request;method=GET:1|c".
+	statsD := statsd.NewClient(statsd.MustUDP(":8125"), "hub.", statsd.WithTagStyle(statsd.TagStyleGraphite))
+	statsD.FlushEvery(5 * time.Second)
+
+	statsDMiddleware := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path := r.URL.Path
+			if len(path) == 1 {
+				path = "index" // for root.
+			} else if path == "/favicon.ico" {
+				next.ServeHTTP(w, r)
+				return
+			} else {
+				path = path[1:] // ignore first slash "/".
+				// replace / with ".".
+				path = strings.Replace(path, "/", ".", -1)
+			}
+
+			// The method and the status code are tags instead of parts of the metric name,
+			// so the number of the metric names does not explode.
+			method := "method:" + r.Method
+			statsD.TaggedIncrement(fmt.Sprintf("%s.request", path), method)
+
+			newResponseWriter := &statusCodeReporter{ResponseWriter: w, statusCode: http.StatusOK}
+
+			stop := statsD.Record(fmt.Sprintf("%s.time", path), 1)
+			next.ServeHTTP(newResponseWriter, r)
+			stop()
+
+			statsD.TaggedIncrement(fmt.Sprintf("%s.response", path), method, "status:"+strconv.Itoa(newResponseWriter.statusCode))
+		})
+	}
+
+	mux := http.DefaultServeMux
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "Hello from index")
+	})
+
+	mux.HandleFunc("/other", func(w http.ResponseWriter, r *http.Request) {
+		statsD.Unique("other.unique", 1)
+		fmt.Fprintln(w, "Hello from other page")
+	})
+
+	http.ListenAndServe(":8080", statsDMiddleware(mux))
+}
@@ -34,12 +34,7 @@ func (w *statusCodeReporter) Write(b []byte) (int, error) {
 }
 
 func main() {
-	statsWriter, err := statsd.UDP(":8125")
-	if err != nil {
-		panic(err)
-	}
-
-	statsD := statsd.NewClient(statsWriter, "hub.")
+	statsD := statsd.NewClient(statsd.MustUDP(":8125"), "hub.")
 	statsD.FlushEvery(5 * time.Second)
 
 	statsDMiddleware := func(next http.Handler) http.Handler {
@@ -0,0 +1,60 @@
+package statsd
+
+import (
+	"math/rand"
+	"time"
+)
+
+// adaptiveWindow is the period over which the write rates of the metrics are measured, see `WithAdaptiveSampling`.
+const adaptiveWindow = time.Second
+
+// adaptiveSampler samples down the metrics which are written more often than its target, see `WithAdaptiveSampling`.
+type adaptiveSampler struct {
+	target float64 // per metric writes per second.
+
+	since  time.Time          // the start of the current measurement window, zero before the first write.
+	counts map[string]int     // the writes of each metric in the current window.
+	rates  map[string]float32 // the sample rates computed at the end of the previous window, only the hot metrics.
+}
+
+func newAdaptiveSampler(target int) *adaptiveSampler {
+	return &adaptiveSampler{
+		target: float64(target),
+		counts: make(map[string]int),
+		rates:  make(map[string]float32),
+	}
+}
+
+// sample reports whether the write of "metricName" should be kept and its effective sample rate,
+// based on the caller's "rate" and the measured write rate of the metric in the previous window.
+// The kept writes are picked by "rng".
+func (s *adaptiveSampler) sample(rng *rand.Rand, now time.Time, metricName string, rate float32) (float32, bool) {
+	if s.since.IsZero() {
+		s.since = now // the clock is known on the first write, see `WithClock`.
+	}
+
+	if elapsed := now.Sub(s.since); elapsed >= adaptiveWindow {
+		s.rates = make(map[string]float32, len(s.rates))
+		for name, n := range s.counts {
+			if perSecond := float64(n) / elapsed.Seconds(); perSecond > s.target {
+				s.rates[name] = float32(s.target / perSecond)
+			}
+		}
+
+		s.counts = make(map[string]int, len(s.counts))
+		s.since = now
+	}
+
+	s.counts[metricName]++ // all the writes count, kept or not, they measure the demand.
+
+	r, ok := s.rates[metricName]
+	if !ok {
+		return rate, true
+	}
+
+	if rng.Float32() >= r {
+		return 0, false
+	}
+
+	return rate * r, true
+}
@@ -0,0 +1,98 @@
+package statsd
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientAdaptiveSampling(t *testing.T) {
+	clock := newFakeClock()
+	w := new(bytes.Buffer)
+	client := NewClientWriter(w, "", WithAdaptiveSampling(10), WithClock(clock), WithFraming(FramingStream))
+	defer client.Close()
+
+	writes := func() []string {
+		for i := 0; i < 1000; i++ {
+			client.Increment("hot")
+		}
+		client.Increment("cold")
+		client.Gauge("gauge", 1) // gauges are not sampled.
+		client.Flush(-1)
+
+		lines := strings.Split(strings.TrimSuffix(w.String(), "\n"), "\n")
+		w.Reset()
+		return lines
+	}
+
+	// the first window is written in full.
+	if lines := writes(); len(lines) != 1002 {
+		t.Fatalf("expected all the 1002 metrics of the first window but got %d", len(lines))
+	}
+
+	clock.Advance(time.Second)
+	clock.Advance(time.Second) // the rates are measured over the elapsed time.
+	lines := writes()
+
+	var hot int
+	for _, line := range lines {
+		switch line {
+		case "hot:1|c|@0.02":
+			hot++
+		case "cold:1|c", "gauge:1|g":
+		default:
+			t.Fatalf("unexpected metric %q", line)
+		}
+	}
+
+	if len(lines)-hot != 2 {
+		t.Fatalf("expected the cold metrics to be written in full but got:\n%v", lines)
+	}
+
+	// 20 expected, a loose bound of the random sampling.
+	if hot == 0 || hot > 80 {
+		t.Fatalf("expected about 20 hot metrics but got %d", hot)
+	}
+}
+
+func TestClientShouldSample(t *testing.T) {
+	client := NewClientWriter(new(bytes.Buffer), "", WithRandSource(rand.NewSource(1)))
+	defer client.Close()
+
+	if !client.ShouldSample(1) || !client.ShouldSample(0) {
+		t.Fatal("expected the rates out of the (0, 1) range to be always sampled")
+	}
+
+	var kept int
+	for i := 0; i < 1000; i++ {
+		if client.ShouldSample(0.25) {
+			kept++
+		}
+	}
+
+	// the same seed picks the same events.
+	other := NewClientWriter(new(bytes.Buffer), "", WithRandSource(rand.NewSource(1)))
+	defer other.Close()
+
+	var otherKept int
+	for i := 0; i < 1000; i++ {
+		if other.ShouldSample(0.25) {
+			otherKept++
+		}
+	}
+
+	if kept != otherKept {
+		t.Fatalf("expected the same decisions for the same seed but got %d and %d", kept, otherKept)
+	}
+
+	if kept < 150 || kept > 350 {
+		t.Fatalf("expected about 250 kept events but got %d", kept)
+	}
+
+	var nilClient *Client
+	if nilClient.ShouldSample(0.5) || NewNoopClient().ShouldSample(1) {
+		t.Fatal("expected nothing to be sampled by a nil or noop client")
+	}
+}
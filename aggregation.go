@@ -0,0 +1,171 @@
+package statsd
+
+import (
+	"strconv"
+	"strings"
+)
+
+// timerAggregate is the client-side aggregation of the timings of a metric, see `WithTimerAggregation`.
+type timerAggregate struct {
+	name  string
+	tags  []string
+	count float64 // upscaled by the sample rate.
+	min   float64
+	max   float64
+	sum   float64
+	n     int // the observations, the mean is sum / n.
+}
+
+// aggregateTimer adds the "value" observations, i.e "12" or "1:2:3", of a timing metric to its aggregate.
+// The values which are not numbers are ignored.
+func (c *Client) aggregateTimer(metricName, value string, rate float32, tags []string) {
+	if rate <= 0 || rate > 1 {
+		rate = 1
+	}
+
+	// the key is built in a scratch buffer, the lookup of a known key does not allocate.
+	key := append(c.timerKey[:0], metricName...)
+	for i, tag := range tags {
+		if i == 0 {
+			key = append(key, '|')
+		} else {
+			key = append(key, ',')
+		}
+		key = append(key, tag...)
+	}
+	c.timerKey = key
+
+	agg, ok := c.timers[string(key)]
+	for len(value) > 0 {
+		s := value
+		if i := strings.IndexByte(value, ':'); i >= 0 {
+			s, value = value[:i], value[i+1:]
+		} else {
+			value = ""
+		}
+
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			continue
+		}
+
+		if !ok {
+			k := string(key)
+			agg = &timerAggregate{name: metricName, tags: append([]string(nil), tags...)} // kept across the flushes.
+			c.timers[k] = agg
+			c.timerKeys = append(c.timerKeys, k)
+			ok = true
+		}
+
+		if agg.n == 0 || v < agg.min {
+			agg.min = v
+		}
+		if agg.n == 0 || v > agg.max {
+			agg.max = v
+		}
+		agg.sum += v
+		agg.count += 1 / float64(rate)
+		agg.n++
+	}
+}
+
+// writeTimerAggregates writes the derived metrics of the aggregated timings, in the order of their first observation,
+// and resets the aggregates: "name.count" as a counter and "name.min", "name.max" and "name.mean" as gauges.
+// The aggregates are kept for the next flush window, so the keys of the hot metrics are not re-allocated,
+// the ones which were idle for a whole window are removed.
+func (c *Client) writeTimerAggregates() {
+	keys := c.timerKeys[:0]
+	for _, key := range c.timerKeys {
+		agg := c.timers[key]
+		if agg.n == 0 {
+			delete(c.timers, key)
+			continue
+		}
+
+		metrics := [...]struct {
+			suffix, value, typ string
+		}{
+			{".count", c.formatFloat(agg.count), Count},
+			{".min", c.formatFloat(agg.min), Gauge},
+			{".max", c.formatFloat(agg.max), Gauge},
+			{".mean", c.formatFloat(agg.sum / float64(agg.n)), Gauge},
+		}
+
+		for _, m := range metrics {
+			// the durations are never negative, the gauges are written raw.
+			if err := c.writeMetricWith(NegativeGaugeRaw, agg.name+m.suffix, m.value, m.typ, 1, agg.tags, 0); err != nil {
+				c.errs = append(c.errs, err)
+			}
+		}
+
+		agg.count, agg.sum, agg.n = 0, 0, 0
+		keys = append(keys, key)
+	}
+
+	c.timerKeys = keys
+}
+
+// Accumulate adds "delta" to the local counter of "metricName", instead of writing it.
+// The sum of each counter is written as a single "name:sum|c" counter on each flush of the whole buffer
+// (the `FlushEvery` ticks, `Flush(-1)` and `Close`) and it is reset to zero,
+// so each flush window reports the accurate count of its own interval, even if the server lost the previous packets.
+func (c *Client) Accumulate(metricName string, delta int) error {
+	return c.AccumulateRate(metricName, delta, 1)
+}
+
+// AccumulateRate same as `Accumulate` but the "delta" is sampled at "rate", i.e the counter of 1 out of 10 events.
+// Each delta is upscaled by 1/rate before it is summed and the sum is written with rate 1,
+// so the sum is the estimated true count of the events no matter how the rates of its deltas are mixed,
+// i.e a delta of 1 at rate 0.5 and a delta of 1 at rate 1 are written as "name:3|c".
+// A rate out of the (0, 1] range is treated as 1.
+func (c *Client) AccumulateRate(metricName string, delta int, rate float32) error {
+	if c.disabled() {
+		return nil
+	}
+
+	if c.IsClosed() {
+		return ErrClosed
+	}
+
+	if rate <= 0 || rate > 1 {
+		rate = 1
+	}
+
+	c.mu.Lock()
+	if c.counters == nil {
+		c.counters = make(map[string]float64)
+	}
+
+	if _, ok := c.counters[metricName]; !ok {
+		c.counterKeys = append(c.counterKeys, metricName)
+	}
+	c.counters[metricName] += float64(delta) / float64(rate)
+	c.unlock()
+
+	return nil
+}
+
+// writeAccumulated writes the sums of the `Accumulate` counters, in the order of their first delta, and resets them.
+func (c *Client) writeAccumulated() {
+	for _, metricName := range c.counterKeys {
+		sum := c.counters[metricName]
+		delete(c.counters, metricName)
+
+		if err := c.writeMetric(metricName, c.formatFloat(sum), Count, 1, nil, 0); err != nil {
+			c.errs = append(c.errs, err)
+		}
+	}
+
+	c.counterKeys = c.counterKeys[:0]
+}
+
+// writeAggregates writes the client-side aggregated metrics, see `WithTimerAggregation` and `Client#Accumulate`.
+func (c *Client) writeAggregates() {
+	if c.timers != nil {
+		c.writeTimerAggregates()
+	}
+
+	if len(c.counterKeys) > 0 {
+		c.writeAccumulated()
+	}
+}
@@ -0,0 +1,138 @@
+package statsd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestClientTimerAggregation(t *testing.T) {
+	w := new(bytes.Buffer)
+	client := NewClientWriter(w, "my_prefix.", WithTimerAggregation(), WithFraming(FramingStream))
+	client.Time("db", 10*time.Millisecond)
+	client.Increment("requests")
+	client.Time("db", 30*time.Millisecond)
+	client.WriteMetric("db", "20", Time, 0.5)
+	client.WriteMetricTags("db", "5", Time, 1, "table:users")
+
+	if err := client.Flush(-1); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "my_prefix.requests:1|c\n" +
+		"my_prefix.db.count:4|c\nmy_prefix.db.min:10|g\nmy_prefix.db.max:30|g\nmy_prefix.db.mean:20|g\n" +
+		"my_prefix.db.count:1|c|#table:users\nmy_prefix.db.min:5|g|#table:users\n" +
+		"my_prefix.db.max:5|g|#table:users\nmy_prefix.db.mean:5|g|#table:users\n"
+	if got := w.String(); expected != got {
+		t.Fatalf("expected:\n[%s]\nbut got:\n[%s]", expected, got)
+	}
+
+	// the aggregates are reset after each flush.
+	w.Reset()
+	client.Time("db", time.Millisecond)
+	client.Close()
+
+	expected = "my_prefix.db.count:1|c\nmy_prefix.db.min:1|g\nmy_prefix.db.max:1|g\nmy_prefix.db.mean:1|g\n"
+	if got := w.String(); expected != got {
+		t.Fatalf("expected:\n[%s]\nbut got:\n[%s]", expected, got)
+	}
+
+	// the aggregates which were idle for a whole flush window are removed.
+	if len(client.timers) != 1 || len(client.timerKeys) != 1 {
+		t.Fatalf("expected only the observed aggregate to be kept but got %d", len(client.timers))
+	}
+}
+
+func TestClientTimerAggregationStrict(t *testing.T) {
+	client := NewClientWriter(ioutil.Discard, "", WithTimerAggregation(), WithStrict())
+	defer client.Close()
+
+	if err := client.WriteMetric("db", "10", Time, 5); err != ErrInvalidRate {
+		t.Fatalf("expected ErrInvalidRate but got %v", err)
+	}
+
+	if err := client.WriteMetric("db\n", "10", Time, 1); err != ErrNewline {
+		t.Fatalf("expected ErrNewline but got %v", err)
+	}
+
+	if len(client.timerKeys) != 0 {
+		t.Fatalf("expected the invalid timings not to be aggregated but got %q", client.timerKeys)
+	}
+}
+
+func TestClientTimerAggregationOverrides(t *testing.T) {
+	w := new(bytes.Buffer)
+	client := NewClientWriter(w, "my_prefix.", WithTimerAggregation(), WithFraming(FramingStream))
+	client.WriteMetricPrefix("other.", "db", "10", Time, 1)
+	client.WriteMetricRawName("Raw.DB", "20", Time, 1)
+	client.Close()
+
+	// the timings of the overrides are written as they are, they are not aggregated under the client's prefix.
+	if expected, got := "other.db:10|ms\nmy_prefix.Raw.DB:20|ms\n", w.String(); expected != got {
+		t.Fatalf("expected:\n[%s]\nbut got:\n[%s]", expected, got)
+	}
+}
+
+func TestClientAccumulate(t *testing.T) {
+	clock := newFakeClock()
+	client := NewClientWriter(ioutil.Discard, "my_prefix.", WithClock(clock))
+	defer client.Close()
+
+	packets := make(chan string, 1)
+	client.OnFlush(func(payload []byte) { packets <- string(payload) })
+
+	expectFlush := func(expected string) {
+		t.Helper()
+		select {
+		case got := <-packets:
+			if got != expected {
+				t.Fatalf("expected [%s] but got [%s]", expected, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected [%s] to be flushed", expected)
+		}
+	}
+
+	client.FlushEvery(time.Second)
+
+	client.Accumulate("requests", 1)
+	client.Accumulate("errors", 1)
+	client.Accumulate("requests", 2)
+	clock.Advance(time.Second)
+	expectFlush("my_prefix.requests:3|c\nmy_prefix.errors:1|c")
+
+	// the next window starts from zero.
+	client.Accumulate("requests", 5)
+	clock.Advance(time.Second)
+	expectFlush("my_prefix.requests:5|c")
+}
+
+func TestClientAccumulateRate(t *testing.T) {
+	w := new(bytes.Buffer)
+	client := NewClientWriter(w, "")
+	defer client.Close()
+
+	client.AccumulateRate("requests", 1, 0.5) // stands for 2 events.
+	client.Accumulate("requests", 1)
+	client.AccumulateRate("requests", 3, 0.25) // stands for 12 events.
+	client.Flush(-1)
+
+	if expected, got := "requests:15|c", w.String(); expected != got {
+		t.Fatalf("expected [%s] but got [%s]", expected, got)
+	}
+}
+
+func BenchmarkClientTimerAggregation(b *testing.B) {
+	client := NewClientWriter(ioutil.Discard, "", WithTimerAggregation())
+	defer client.Close()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		client.WriteMetricTags("my_timer", "10", Time, 1, "status:200")
+		if i%100 == 0 {
+			client.Flush(-1)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package statsd
+
+import "time"
+
+// Clock is the source of the time of the client, see `WithClock`.
+// Useful to test time-based code without real sleeps.
+type Clock interface {
+	Now() time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker is the ticker of a `Clock`, see `time.Ticker`.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// realClock is the default `Clock`, it uses the `time` package.
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) NewTicker(d time.Duration) Ticker { return realTicker{time.NewTicker(d)} }
+
+type realTicker struct {
+	*time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time { return t.Ticker.C }
@@ -0,0 +1,69 @@
+package statsd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+type debugWriter struct {
+	w io.Writer
+}
+
+// DebugWriter returns an `io.WriteCloser` which writes the flushed metrics to "w" in a human-readable form,
+// one metric per line with the local time of the flush, i.e:
+// 15:04:05.000 c  my_prefix.my_metric = 1 @0.5
+//
+// Useful during development, i.e `NewClient(DebugWriter(os.Stdout), "my_prefix.")`.
+// The "w" is not closed by the returned writer's `Close`.
+func DebugWriter(w io.Writer) io.WriteCloser {
+	return &debugWriter{w: w}
+}
+
+func (w *debugWriter) Write(b []byte) (int, error) {
+	now := time.Now().Format("15:04:05.000")
+
+	var out bytes.Buffer
+	for _, line := range strings.Split(string(b), "\n") {
+		if line == "" {
+			continue
+		}
+
+		out.WriteString(now)
+		out.WriteByte(' ')
+		out.WriteString(formatDebugLine(line))
+		out.WriteByte('\n')
+	}
+
+	if _, err := w.w.Write(out.Bytes()); err != nil {
+		return 0, err
+	}
+
+	return len(b), nil
+}
+
+func (w *debugWriter) Close() error {
+	return nil
+}
+
+// formatDebugLine converts a "name:value|type|..." metric line to "type name = value ...".
+func formatDebugLine(line string) string {
+	sep := strings.IndexByte(line, ':')
+	if sep <= 0 {
+		return line
+	}
+
+	name, fields := line[:sep], strings.Split(line[sep+1:], "|")
+	if len(fields) < 2 {
+		return line
+	}
+
+	s := fmt.Sprintf("%-2s %s = %s", fields[1], name, fields[0])
+	if len(fields) > 2 {
+		s += " " + strings.Join(fields[2:], " ") // sample rate, tags and etc.
+	}
+
+	return s
+}
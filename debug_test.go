@@ -0,0 +1,25 @@
+package statsd
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+)
+
+func TestDebugWriter(t *testing.T) {
+	w := new(bytes.Buffer)
+	client := NewClient(DebugWriter(w), "my_prefix.")
+	client.WriteMetric("my_metric", "1", Count, 0.5)
+	client.TaggedIncrement("my_metric2", "env:dev")
+	client.Time("my_timer", 0)
+	client.Close()
+
+	expected := regexp.MustCompile(`^\d\d:\d\d:\d\d\.\d{3} c  my_prefix\.my_metric = 1 @0\.5
+\d\d:\d\d:\d\d\.\d{3} c  my_prefix\.my_metric2 = 1 #env:dev
+\d\d:\d\d:\d\d\.\d{3} ms my_prefix\.my_timer = 0
+$`)
+
+	if got := w.String(); !expected.MatchString(got) {
+		t.Fatalf("expected debug output to match:\n%s\nbut got:\n%s", expected, got)
+	}
+}
@@ -0,0 +1,156 @@
+package statsd
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+)
+
+// Encoding is the wire format of the packets written to the statsd server, see `WithEncoding`.
+type Encoding uint8
+
+const (
+	// EncodingText writes the metrics in the statsd line protocol, i.e "my_metric:1|c". This is the default encoding.
+	EncodingText Encoding = iota
+	// EncodingMsgpack writes each packet as a MessagePack array of metrics,
+	// each metric is an array of [name, value, type, rate, tags, timestamp]:
+	// the name and the type are strings, the value is a float64 (or a string if it is not a single number, i.e "1:2:3",
+	// or if it is a signed gauge, i.e the "+5" delta of `Client#GaugeDelta`, so the deltas are not confused with the sets),
+	// the rate is a float64, the tags are an array of strings (the `TagStyleDatadog` tags, the rest of the styles
+	// are part of the name) and the timestamp is an unsigned integer of unix seconds, zero if not set.
+	// Read more at: https://github.com/msgpack/msgpack/blob/master/spec.md
+	//
+	// The metrics are still buffered as lines, the max packet size bounds the size of the lines,
+	// the encoded packet can be slightly bigger.
+	EncodingMsgpack
+)
+
+// appendMsgpackPacket appends the new line separated metric "lines" of a packet, as a MessagePack array, to "dst".
+func appendMsgpackPacket(dst, lines []byte, d delimiters) []byte {
+	dst = appendMsgpackArrayHeader(dst, bytes.Count(bytes.TrimSuffix(lines, newLine), newLine)+1)
+
+	for len(lines) > 0 {
+		line := lines
+		if i := bytes.IndexByte(lines, '\n'); i >= 0 {
+			line, lines = lines[:i], lines[i+1:]
+		} else {
+			lines = nil
+		}
+
+		dst = appendMsgpackMetric(dst, line, d)
+	}
+
+	return dst
+}
+
+// appendMsgpackMetric appends a "name:value|type[|@rate][|#tags][|Ttimestamp]" metric line
+// as a MessagePack array of [name, value, type, rate, tags, timestamp].
+func appendMsgpackMetric(dst, line []byte, d delimiters) []byte {
+	var (
+		name, value, typ = line, []byte(nil), []byte(nil)
+		rate             = 1.0
+		tags             [][]byte
+		timestamp        uint64
+	)
+
+	if i := bytes.IndexByte(line, d.nameValue); i >= 0 {
+		name = line[:i]
+		fields := bytes.Split(line[i+1:], []byte{d.valueType})
+		value = fields[0]
+		if len(fields) > 1 {
+			typ = fields[1]
+		}
+
+		for i, field := range fields {
+			if i < 2 || len(field) == 0 {
+				continue
+			}
+
+			switch field[0] {
+			case d.rate:
+				if r, err := strconv.ParseFloat(string(field[1:]), 32); err == nil {
+					rate = r
+				}
+			case '#':
+				tags = bytes.Split(field[1:], []byte{','})
+			case 'T':
+				timestamp, _ = strconv.ParseUint(string(field[1:]), 10, 64)
+			}
+		}
+	}
+
+	dst = appendMsgpackArrayHeader(dst, 6)
+	dst = appendMsgpackString(dst, name)
+	if isSignedGauge(value, typ) {
+		dst = appendMsgpackString(dst, value) // a delta, it would be an absolute set as a number.
+	} else if v, err := strconv.ParseFloat(string(value), 64); err == nil {
+		dst = appendMsgpackFloat(dst, v)
+	} else {
+		dst = appendMsgpackString(dst, value)
+	}
+	dst = appendMsgpackString(dst, typ)
+	dst = appendMsgpackFloat(dst, rate)
+	dst = appendMsgpackArrayHeader(dst, len(tags))
+	for _, tag := range tags {
+		dst = appendMsgpackString(dst, tag)
+	}
+
+	return appendMsgpackUint(dst, timestamp)
+}
+
+// isSignedGauge reports whether the "value" of a metric is a gauge delta, i.e "+5" or "-5", see `Client#GaugeDelta`.
+func isSignedGauge(value, typ []byte) bool {
+	return len(value) > 0 && (value[0] == '+' || value[0] == '-') && string(typ) == Gauge
+}
+
+func appendMsgpackArrayHeader(dst []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(dst, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		return appendMsgpackBigEndian(append(dst, 0xdc), uint64(n), 2)
+	default:
+		return appendMsgpackBigEndian(append(dst, 0xdd), uint64(n), 4)
+	}
+}
+
+func appendMsgpackString(dst, s []byte) []byte {
+	switch n := len(s); {
+	case n < 32:
+		dst = append(dst, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		dst = append(dst, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		dst = appendMsgpackBigEndian(append(dst, 0xda), uint64(n), 2)
+	default:
+		dst = appendMsgpackBigEndian(append(dst, 0xdb), uint64(n), 4)
+	}
+
+	return append(dst, s...)
+}
+
+func appendMsgpackFloat(dst []byte, v float64) []byte {
+	return appendMsgpackBigEndian(append(dst, 0xcb), math.Float64bits(v), 8)
+}
+
+func appendMsgpackUint(dst []byte, v uint64) []byte {
+	switch {
+	case v < 128:
+		return append(dst, byte(v)) // positive fixint.
+	case v <= math.MaxUint16:
+		return appendMsgpackBigEndian(append(dst, 0xcd), v, 2)
+	case v <= math.MaxUint32:
+		return appendMsgpackBigEndian(append(dst, 0xce), v, 4)
+	default:
+		return appendMsgpackBigEndian(append(dst, 0xcf), v, 8)
+	}
+}
+
+// appendMsgpackBigEndian appends the "size" low bytes of "v" in big-endian order.
+func appendMsgpackBigEndian(dst []byte, v uint64, size int) []byte {
+	for i := size - 1; i >= 0; i-- {
+		dst = append(dst, byte(v>>(8*uint(i))))
+	}
+
+	return dst
+}
@@ -0,0 +1,48 @@
+package statsd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestClientEncodingMsgpack(t *testing.T) {
+	w := new(bytes.Buffer)
+	client := NewClientWriter(w, "p.", WithEncoding(EncodingMsgpack), WithGlobalTags("env:dev"))
+	client.WriteMetric("m", "1", Count, 0.5)
+	client.WriteMetricAt("g", "1:2", Gauge, 1, time.Unix(1000, 0))
+	client.Close()
+
+	expected := []byte{
+		0x92, // array of 2 metrics.
+		0x96, 0xa3, 'p', '.', 'm', 0xcb, 0x3f, 0xf0, 0, 0, 0, 0, 0, 0, 0xa1, 'c', 0xcb, 0x3f, 0xe0, 0, 0, 0, 0, 0, 0,
+		0x91, 0xa7, 'e', 'n', 'v', ':', 'd', 'e', 'v', 0x00,
+		0x96, 0xa3, 'p', '.', 'g', 0xa3, '1', ':', '2', 0xa1, 'g', 0xcb, 0x3f, 0xf0, 0, 0, 0, 0, 0, 0,
+		0x91, 0xa7, 'e', 'n', 'v', ':', 'd', 'e', 'v', 0xcd, 0x03, 0xe8,
+	}
+	if got := w.Bytes(); !bytes.Equal(expected, got) {
+		t.Fatalf("expected:\n%x\nbut got:\n%x", expected, got)
+	}
+}
+
+func TestClientEncodingMsgpackGaugeDelta(t *testing.T) {
+	encode := func(write func(c *Client)) []byte {
+		w := new(bytes.Buffer)
+		client := NewClientWriter(w, "", WithEncoding(EncodingMsgpack))
+		write(client)
+		client.Close()
+		return w.Bytes()
+	}
+
+	set := encode(func(c *Client) { c.Gauge("g", 5) })
+	delta := encode(func(c *Client) { c.GaugeDelta("g", 5) })
+	if bytes.Equal(set, delta) {
+		t.Fatalf("expected the gauge delta to be encoded differently than the gauge set but got %x", delta)
+	}
+
+	// the delta is kept as a string.
+	expected := []byte{0x91, 0x96, 0xa1, 'g', 0xa2, '+', '5', 0xa1, 'g', 0xcb, 0x3f, 0xf0, 0, 0, 0, 0, 0, 0, 0x90, 0x00}
+	if !bytes.Equal(expected, delta) {
+		t.Fatalf("expected:\n%x\nbut got:\n%x", expected, delta)
+	}
+}
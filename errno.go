@@ -0,0 +1,17 @@
+//go:build !plan9
+// +build !plan9
+
+package statsd
+
+import "syscall"
+
+// temporaryErrno reports whether "err" is a system call error and whether it is a transient one,
+// i.e "ENOBUFS" or "EAGAIN" of a socket whose buffers are full.
+func temporaryErrno(err error) (temporary, ok bool) {
+	errno, ok := err.(syscall.Errno)
+	if !ok {
+		return false, false
+	}
+
+	return errno == syscall.ENOBUFS || errno == syscall.EAGAIN, true
+}
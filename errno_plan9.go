@@ -0,0 +1,7 @@
+package statsd
+
+// temporaryErrno reports whether "err" is a system call error and whether it is a transient one,
+// the plan9 errors are strings, they are checked through their `Temporary` method only.
+func temporaryErrno(err error) (temporary, ok bool) {
+	return false, false
+}
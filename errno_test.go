@@ -0,0 +1,24 @@
+//go:build !plan9
+// +build !plan9
+
+package statsd
+
+import (
+	"net"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestIsTemporaryErrno(t *testing.T) {
+	for err, expected := range map[error]bool{
+		&net.OpError{Err: os.NewSyscallError("write", syscall.ENOBUFS)}: true,
+		&net.OpError{Err: os.NewSyscallError("write", syscall.EAGAIN)}:  true,
+		&net.OpError{Err: os.NewSyscallError("write", syscall.EPIPE)}:   false,
+		syscall.ENOBUFS: true,
+	} {
+		if got := isTemporary(err); expected != got {
+			t.Fatalf("expected isTemporary(%v) to be %v", err, expected)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package statsd
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// Group is a set of clients, i.e one per prefix, which share a single writer, buffer and flush ticker.
+// The clients of a group are views: each metric they write is encoded with their own prefix and options
+// and it is moved straight to the group's buffer, which packs the metrics of all the clients in the same packets.
+//
+// Useful for multi-tenant libraries which would otherwise hold a socket and a flush goroutine per client.
+//
+// Usage:
+// conn, _ := UDP(":8125")
+// g := NewGroup(conn)
+// g.FlushEvery(4 * time.Second)
+// api, db := g.Client("api."), g.Client("db.")
+type Group struct {
+	root *Client
+
+	mu      sync.Mutex
+	clients []*Client
+}
+
+// NewGroup returns a new `Group` which writes to "writeCloser",
+// the "opts" customize the shared buffer, i.e `WithRateLimit` or `WithMaxBufferBytes`.
+func NewGroup(writeCloser io.WriteCloser, opts ...Option) *Group {
+	g := &Group{root: NewClient(writeCloser, "", opts...)}
+	g.root.beforeTick = g.tickClients
+	return g
+}
+
+// Client returns a new client of the group with its own "prefix" and "opts", i.e `WithTagStyle`.
+// Its metrics are appended straight to the group's buffer, so the packet size, the encoding and the framing
+// are the group's ones (see `NewGroup`), the client's options of them are ignored.
+// Its `Close` does not close the group's writer, see `Group#Close`.
+func (g *Group) Client(prefix string, opts ...Option) *Client {
+	// the raw lines (i.e `WriteRaw` and the self metrics) are moved to the group's buffer as soon as they are written,
+	// as plain text lines.
+	opts = append(opts[:len(opts):len(opts)], WithFlushEveryN(1), WithEncoding(EncodingText), WithFraming(FramingStream))
+	c := NewClient(groupWriter{g.root}, prefix, opts...)
+	c.group = g.root
+
+	g.mu.Lock()
+	g.clients = append(g.clients, c)
+	g.mu.Unlock()
+
+	return c
+}
+
+// FlushEvery same as `Client#FlushEvery` but for the shared buffer of all the group's clients,
+// a single ticker and goroutine serve the whole group. On each tick the clients write their registered gauges,
+// self metrics and aggregates (see `RegisterGauge`, `WithSelfMetrics` and `WithTimerAggregation`)
+// before the shared buffer is flushed.
+func (g *Group) FlushEvery(dur time.Duration) error {
+	return g.root.FlushEvery(dur)
+}
+
+// Flush writes the aggregates of all the group's clients and flushes the shared buffer, see `Client#Flush`.
+func (g *Group) Flush() error {
+	for _, c := range g.snapshot() {
+		c.Flush(-1) // the write errors are returned by the shared buffer, the closed clients have nothing to write.
+	}
+
+	return g.root.Flush(-1)
+}
+
+func (g *Group) snapshot() []*Client {
+	g.mu.Lock()
+	clients := g.clients
+	g.mu.Unlock()
+
+	return clients
+}
+
+// tickClients is called on each tick of the group's `FlushEvery`, before the shared buffer is flushed.
+func (g *Group) tickClients() {
+	for _, c := range g.snapshot() {
+		c.tick()
+	}
+}
+
+// Close closes all the group's clients, flushes the shared buffer and closes the group's writer.
+func (g *Group) Close() error {
+	g.mu.Lock()
+	clients := g.clients
+	g.clients = nil
+	g.mu.Unlock()
+
+	for _, c := range clients {
+		c.Close()
+	}
+
+	return g.root.Close()
+}
+
+// appendGroupLines appends the metric lines of the group's client "src", with its prefixes and tag style,
+// straight to the group's buffer. It is called under the lock of "src".
+func (c *Client) appendGroupLines(src *Client, metricName, value, typ string, rate float32, tags []string, timestamp int64) error {
+	if c.IsClosed() {
+		return ErrClosed
+	}
+
+	c.mu.Lock()
+	n := len(c.buf)
+	c.buf = appendMetric(c.buf, src.prefix, metricName, value, typ, rate, src.tagStyle, src.delimiters, tags, timestamp)
+	// the write errors of the shared buffer are not returned, the lines are kept there to be retried,
+	// they are returned by the `Group#Flush` instead.
+	c.flushFull(n)
+
+	for _, prefix := range src.additionalPrefixes {
+		n = len(c.buf)
+		c.buf = appendMetric(c.buf, prefix, metricName, value, typ, rate, src.tagStyle, src.delimiters, tags, timestamp)
+		c.flushFull(n)
+	}
+	c.unlock()
+
+	return nil
+}
+
+// groupWriter is the writer of the group's clients,
+// it writes their flushed raw lines to the group's client.
+type groupWriter struct {
+	root *Client
+}
+
+func (w groupWriter) Write(b []byte) (int, error) {
+	// the write errors of the shared buffer are not returned, the lines are kept there to be retried,
+	// they are returned by the `Group#Flush` instead.
+	if err := w.root.WriteBatch(b); err == ErrClosed {
+		return 0, err
+	}
+
+	return len(b), nil
+}
+
+func (groupWriter) Close() error {
+	return nil
+}
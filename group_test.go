@@ -0,0 +1,108 @@
+package statsd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestGroup(t *testing.T) {
+	w := &countingWriter{ClosingBuffer: ClosingBuffer{new(bytes.Buffer)}}
+	g := NewGroup(w)
+
+	api := g.Client("api.")
+	db := g.Client("db.", WithGlobalTags("env:dev"))
+
+	api.Increment("requests")
+	db.Gauge("connections", 2)
+	api.Time("latency", time.Second)
+
+	if w.Len() != 0 {
+		t.Fatalf("expected nothing to be written before the flush but got [%s]", w.String())
+	}
+
+	if err := g.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "api.requests:1|c\ndb.connections:2|g|#env:dev\napi.latency:1000|ms"
+	if got := w.String(); expected != got {
+		t.Fatalf("expected:\n[%s]\nbut got:\n[%s]", expected, got)
+	}
+
+	if w.writes != 1 {
+		t.Fatalf("expected a single packet but got %d", w.writes)
+	}
+
+	if err := g.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !api.IsClosed() || !db.IsClosed() {
+		t.Fatalf("expected the group's clients to be closed")
+	}
+}
+
+func TestGroupAggregates(t *testing.T) {
+	w := &ClosingBuffer{new(bytes.Buffer)}
+	g := NewGroup(w)
+	defer g.Close()
+
+	api := g.Client("api.", WithTimerAggregation())
+	api.Accumulate("requests", 2)
+	api.Time("latency", time.Second)
+
+	if err := g.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "api.latency.count:1|c\napi.latency.min:1000|g\napi.latency.max:1000|g\napi.latency.mean:1000|g\napi.requests:2|c"
+	if got := w.String(); expected != got {
+		t.Fatalf("expected:\n[%s]\nbut got:\n[%s]", expected, got)
+	}
+}
+
+func TestGroupFlushEvery(t *testing.T) {
+	g := NewGroup(&ClosingBuffer{new(bytes.Buffer)})
+	defer g.Close()
+
+	packets := make(chan string, 10)
+	g.root.OnFlush(func(payload []byte) { packets <- string(payload) })
+
+	api := g.Client("api.")
+	api.RegisterGauge("connections", func() int { return 3 })
+	api.Accumulate("requests", 2)
+	g.FlushEvery(10 * time.Millisecond)
+
+	select {
+	case got := <-packets:
+		if expected := "api.connections:3|g\napi.requests:2|c"; expected != got {
+			t.Fatalf("expected:\n[%s]\nbut got:\n[%s]", expected, got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the group's clients to be flushed")
+	}
+}
+
+func TestGroupClientOptions(t *testing.T) {
+	w := &ClosingBuffer{new(bytes.Buffer)}
+	g := NewGroup(w)
+	defer g.Close()
+
+	// the encoding and the framing are the group's ones.
+	api := g.Client("api.", WithEncoding(EncodingMsgpack), WithFraming(FramingUDP))
+	api.Increment("requests")
+	api.WriteRaw("raw:1|c")
+
+	if expected, got := 2, bytes.Count(g.root.buf, newLine); expected != got {
+		t.Fatalf("expected %d lines in the group's buffer but got %d", expected, got)
+	}
+
+	if err := g.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := "api.requests:1|c\nraw:1|c", w.String(); expected != got {
+		t.Fatalf("expected:\n[%s]\nbut got:\n[%s]", expected, got)
+	}
+}
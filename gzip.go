@@ -0,0 +1,88 @@
+package statsd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"sync"
+)
+
+type gzipWriter struct {
+	w io.WriteCloser
+
+	mu  sync.Mutex
+	buf bytes.Buffer // the uncompressed metrics since the last flush.
+	out bytes.Buffer
+	zw  *gzip.Writer
+}
+
+// GzipWriter returns an `io.WriteCloser` which buffers the metrics and writes them gzip-compressed to "w"
+// on each client's flush and on `Close`, each flush is a complete gzip stream written with a single write,
+// i.e `NewClient(GzipWriter(HTTPWriter(url, nil)), "my_prefix.")` sends a compressed request body per flush.
+// The packets are separated by new lines and each stream ends with a new line. If "w" buffers writes itself (i.e `HTTPWriter`) it is flushed too.
+//
+// Useful for bandwidth-constrained links with TCP or HTTP transports, the receiver must decompress the data,
+// it is not useful with UDP where each packet should be a plain statsd datagram.
+func GzipWriter(w io.WriteCloser) io.WriteCloser {
+	return &gzipWriter{w: w}
+}
+
+func (w *gzipWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	if n := w.buf.Len(); n > 0 && w.buf.Bytes()[n-1] != '\n' {
+		w.buf.WriteByte('\n')
+	}
+	n, err := w.buf.Write(b)
+	w.mu.Unlock()
+
+	return n, err
+}
+
+// Flush compresses and writes the buffered metrics, if any. On failure the metrics are kept for the next `Flush`.
+func (w *gzipWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.buf.Len() == 0 {
+		return nil
+	}
+
+	if w.buf.Bytes()[w.buf.Len()-1] != '\n' {
+		w.buf.WriteByte('\n') // so the decompressed streams can be concatenated.
+	}
+
+	w.out.Reset()
+	if w.zw == nil {
+		w.zw = gzip.NewWriter(&w.out)
+	} else {
+		w.zw.Reset(&w.out)
+	}
+
+	if _, err := w.zw.Write(w.buf.Bytes()); err != nil {
+		return err
+	}
+
+	if err := w.zw.Close(); err != nil {
+		return err
+	}
+
+	if _, err := w.w.Write(w.out.Bytes()); err != nil {
+		return err
+	}
+	w.buf.Reset()
+
+	if f, ok := w.w.(flusher); ok {
+		return f.Flush()
+	}
+
+	return nil
+}
+
+func (w *gzipWriter) Close() error {
+	err := w.Flush()
+	if cerr := w.w.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
@@ -0,0 +1,68 @@
+package statsd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"testing"
+)
+
+func TestGzipWriter(t *testing.T) {
+	w := &countingWriter{ClosingBuffer: ClosingBuffer{new(bytes.Buffer)}}
+	client := NewClient(GzipWriter(nopCloser{w}), "my_prefix.")
+	client.Increment("my_metric")
+	client.Increment("my_metric2")
+	client.Flush(-1)
+	client.Increment("my_metric3")
+	client.Close()
+
+	if expected, got := 2, w.writes; expected != got {
+		t.Fatalf("expected %d compressed writes but got %d", expected, got)
+	}
+
+	// the concatenated gzip streams are read as one.
+	r, err := gzip.NewReader(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "my_prefix.my_metric:1|c\nmy_prefix.my_metric2:1|c\nmy_prefix.my_metric3:1|c\n"
+	if got := string(b); expected != got {
+		t.Fatalf("expected:\n[%s]\nbut got:\n[%s]", expected, got)
+	}
+}
+
+func TestGzipWriterPackets(t *testing.T) {
+	w := &countingWriter{ClosingBuffer: ClosingBuffer{new(bytes.Buffer)}}
+	client := NewClient(GzipWriter(nopCloser{w}), "")
+	client.SetMaxPackageSize(len("my_metric:1|c"))
+	client.Increment("my_metric")
+	client.Increment("my_metric")
+	client.Increment("my_metric")
+	client.Flush(-1)
+
+	// the packets of a flush are compressed as a single stream.
+	if expected, got := 1, w.writes; expected != got {
+		t.Fatalf("expected %d compressed writes but got %d", expected, got)
+	}
+	client.Close()
+
+	r, err := gzip.NewReader(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := "my_metric:1|c\nmy_metric:1|c\nmy_metric:1|c\n", string(b); expected != got {
+		t.Fatalf("expected:\n[%s]\nbut got:\n[%s]", expected, got)
+	}
+}
@@ -0,0 +1,50 @@
+package statsd
+
+// history keeps the most recent metric lines, see `WithHistory`.
+type history struct {
+	lines []string
+	next  int
+	full  bool
+}
+
+func newHistory(n int) *history {
+	return &history{lines: make([]string, n)}
+}
+
+func (h *history) add(line string) {
+	h.lines[h.next] = line
+	h.next++
+	if h.next == len(h.lines) {
+		h.next = 0
+		h.full = true
+	}
+}
+
+// list returns a copy of the lines, from the oldest to the newest.
+func (h *history) list() []string {
+	if !h.full {
+		return append([]string(nil), h.lines[:h.next]...)
+	}
+
+	list := make([]string, 0, len(h.lines))
+	list = append(list, h.lines[h.next:]...)
+	return append(list, h.lines[:h.next]...)
+}
+
+// History returns the most recent metric lines written to the buffer, from the oldest to the newest,
+// even if they are already flushed, see `WithHistory`.
+// Useful to dump the latest metrics on a crash for postmortem debugging.
+func (c *Client) History() []string {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.unlock()
+
+	if c.history == nil {
+		return nil
+	}
+
+	return c.history.list()
+}
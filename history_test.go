@@ -0,0 +1,31 @@
+package statsd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+)
+
+func TestClientHistory(t *testing.T) {
+	client := NewClientWriter(ioutil.Discard, "my_prefix.", WithHistory(3))
+	defer client.Close()
+
+	if got := client.History(); len(got) != 0 {
+		t.Fatalf("expected empty history but got %q", got)
+	}
+
+	client.Increment("a")
+	client.Increment("b")
+
+	if expected, got := []string{"my_prefix.a:1|c", "my_prefix.b:1|c"}, client.History(); fmt.Sprint(expected) != fmt.Sprint(got) {
+		t.Fatalf("expected %q but got %q", expected, got)
+	}
+
+	client.Flush(-1)
+	client.Increment("c")
+	client.WriteRaw("d:1|c")
+
+	if expected, got := []string{"my_prefix.b:1|c", "my_prefix.c:1|c", "d:1|c"}, client.History(); fmt.Sprint(expected) != fmt.Sprint(got) {
+		t.Fatalf("expected %q but got %q", expected, got)
+	}
+}
@@ -0,0 +1,82 @@
+package statsd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+)
+
+// flusher is implemented by writers which buffer the flushed metrics themselves,
+// i.e the `HTTPWriter`. The client calls its `Flush` once per flush of the whole buffer, after its last packet,
+// so all the packets written since the previous flush are delivered as a single batch.
+type flusher interface {
+	Flush() error
+}
+
+type httpWriter struct {
+	url    string
+	client *http.Client
+
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+// HTTPWriter returns an `io.WriteCloser` which buffers the metrics
+// and sends them as the body of a POST request to the "url" on each client's flush and on `Close`.
+// Each write (a packet of newline-separated metrics) is separated by a newline in the request body.
+//
+// Useful on environments where holding an UDP socket is impractical, i.e serverless functions.
+//
+// The "client" can be nil, `http.DefaultClient` is used instead.
+//
+// Usage:
+// NewClient(HTTPWriter("https://intake.example.com/statsd", nil), "my_prefix.")
+func HTTPWriter(url string, client *http.Client) io.WriteCloser {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &httpWriter{url: url, client: client}
+}
+
+func (w *httpWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	if w.buf.Len() > 0 {
+		w.buf.WriteByte('\n')
+	}
+	n, err := w.buf.Write(b)
+	w.mu.Unlock()
+
+	return n, err
+}
+
+// Flush sends the buffered metrics, if any. On failure the metrics are kept for the next `Flush`.
+func (w *httpWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.buf.Len() == 0 {
+		return nil
+	}
+
+	resp, err := w.client.Post(w.url, "text/plain", bytes.NewReader(w.buf.Bytes()))
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("statsd: http: unexpected status code %d", resp.StatusCode)
+	}
+
+	w.buf.Reset()
+	return nil
+}
+
+func (w *httpWriter) Close() error {
+	return w.Flush()
+}
@@ -0,0 +1,61 @@
+package statsd
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPWriter(t *testing.T) {
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("expected POST request but got %s", r.Method)
+		}
+
+		b, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+	}))
+	defer srv.Close()
+
+	client := NewClient(HTTPWriter(srv.URL, nil), "my_prefix.")
+	client.Increment("my_metric")
+	client.Increment("my_metric2")
+	client.Flush(-1)
+	client.Increment("my_metric3")
+	client.Close()
+
+	expected := []string{"my_prefix.my_metric:1|c\nmy_prefix.my_metric2:1|c", "my_prefix.my_metric3:1|c"}
+	if len(bodies) != len(expected) {
+		t.Fatalf("expected %d requests but got %d: %q", len(expected), len(bodies), bodies)
+	}
+
+	for i := range expected {
+		if expected[i] != bodies[i] {
+			t.Fatalf("[%d] expected body [%s] but got [%s]", i, expected[i], bodies[i])
+		}
+	}
+}
+
+func TestHTTPWriterPackets(t *testing.T) {
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+	}))
+	defer srv.Close()
+
+	client := NewClient(HTTPWriter(srv.URL, nil), "")
+	client.SetMaxPackageSize(len("my_metric:1|c"))
+	client.Increment("my_metric")
+	client.Increment("my_metric")
+	client.Increment("my_metric")
+	client.Flush(-1)
+	client.Close()
+
+	// the packets of a flush are sent as a single request.
+	if expected := "my_metric:1|c\nmy_metric:1|c\nmy_metric:1|c"; len(bodies) != 1 || bodies[0] != expected {
+		t.Fatalf("expected a single request of [%s] but got %q", expected, bodies)
+	}
+}
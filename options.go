@@ -0,0 +1,371 @@
+package statsd
+
+import (
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Option is a function which customizes a `Client`,
+// it can be passed on the `NewClient`.
+type Option func(*Client)
+
+// WithRateLimit limits the packets sent to the statsd server to "packetsPerSec" packets per second,
+// useful to protect a shared statsd server from a noisy client.
+//
+// When the limit is reached the flushes are deferred and the metrics are kept
+// in the buffer until the next flush.
+// The buffer can keep up to 16 packets (see `SetMaxPackageSize`) unless `WithMaxBufferBytes` is used,
+// after that the oldest metrics are dropped, see `Client#Dropped`.
+func WithRateLimit(packetsPerSec int) Option {
+	return func(c *Client) {
+		if packetsPerSec <= 0 {
+			return
+		}
+
+		c.limiter = newTokenBucket(packetsPerSec)
+	}
+}
+
+// WithTagStyle sets the format of the metric tags, see `Client#WriteMetricTags`.
+// Defaults to `TagStyleDatadog`.
+func WithTagStyle(style TagStyle) Option {
+	return func(c *Client) {
+		c.tagStyle = style
+	}
+}
+
+// WithDefaultRate sets the sample "rate" of the "typ" metric type (i.e `Time`) which is used
+// by the shortcut methods, i.e `Client#Time`, `Client#Count` and `Client#Increment`.
+// A rate below 1 samples the writes of the shortcuts: 1 out of 1/rate writes is kept, at random (see `WithRandSource`),
+// and it is written with the "|@rate" so the server upscales it. Defaults to 1 for all metric types.
+func WithDefaultRate(typ string, rate float32) Option {
+	return func(c *Client) {
+		if c.rates == nil {
+			c.rates = make(map[string]float32)
+		}
+
+		c.rates[typ] = rate
+	}
+}
+
+// WithFraming sets the way the metrics are framed when written to the statsd server.
+// Defaults to `FramingUDP`, use `FramingStream` for byte-stream transports, i.e TCP.
+func WithFraming(mode FramingMode) Option {
+	return func(c *Client) {
+		c.framing = mode
+	}
+}
+
+// WithNegativeGaugeStrategy sets the way the negative gauge values are written.
+// Defaults to `NegativeGaugeReset`.
+func WithNegativeGaugeStrategy(strategy NegativeGaugeStrategy) Option {
+	return func(c *Client) {
+		c.negativeGauges = strategy
+	}
+}
+
+// WithGlobalTags adds "tags" to all metrics written by the client, before the per-metric tags.
+// Each tag should be in the form of "key:value", see `WithTagStyle` too.
+func WithGlobalTags(tags ...string) Option {
+	return func(c *Client) {
+		c.tags = append(c.tags, tags...)
+	}
+}
+
+// WithHostTag adds the "host:<hostname>" global tag, the hostname is the `os.Hostname`.
+// If the hostname can't be retrieved then the tag is not added.
+func WithHostTag() Option {
+	return func(c *Client) {
+		hostname, err := os.Hostname()
+		if err != nil || hostname == "" {
+			return
+		}
+
+		c.tags = append(c.tags, "host:"+hostname)
+	}
+}
+
+// WithStrict makes the client to return an error, i.e `ErrInvalidRate`, when a metric is not valid
+// instead of correcting it.
+func WithStrict() Option {
+	return func(c *Client) {
+		c.strict = true
+	}
+}
+
+// WithEnvTags adds global tags whose values are read from environment variables,
+// the "mapping" keys are the environment variable names and the values are the tag keys,
+// i.e {"POD_NAME": "pod", "POD_NAMESPACE": "namespace"} for the Kubernetes downward API.
+// The variables are read once, unset or empty variables are skipped.
+func WithEnvTags(mapping map[string]string) Option {
+	return func(c *Client) {
+		names := make([]string, 0, len(mapping))
+		for name := range mapping {
+			names = append(names, name)
+		}
+		sort.Strings(names) // keep the tags order stable.
+
+		for _, name := range names {
+			if value := os.Getenv(name); value != "" {
+				c.tags = append(c.tags, mapping[name]+":"+value)
+			}
+		}
+	}
+}
+
+// WithMaxBufferBytes limits the size of the buffer to "n" bytes.
+// The buffer grows beyond the max packet size (see `SetMaxPackageSize`) only when the flushes fail,
+// i.e a blocked socket, or are deferred, see `WithRateLimit`.
+// When the limit is exceeded the oldest metrics are dropped, see `Client#Dropped`.
+// A limit lower than the max packet size is raised to the max packet size.
+// Defaults to no limit.
+func WithMaxBufferBytes(n int) Option {
+	return func(c *Client) {
+		c.maxBufferSize = n
+	}
+}
+
+// WithClock sets the source of the time of the client,
+// it is used by the `FlushEvery`, `Record`, `Timer` and `WithRateLimit`.
+// Useful for tests. Defaults to the `time` package.
+func WithClock(clock Clock) Option {
+	return func(c *Client) {
+		if clock != nil {
+			c.clock = clock
+		}
+	}
+}
+
+// WithFlushEveryN flushes the buffered metrics when they reach "n" metrics,
+// in addition to the max packet size (see `SetMaxPackageSize`) and the `FlushEvery` triggers.
+// Useful for predictable batching when the metric sizes vary widely.
+func WithFlushEveryN(n int) Option {
+	return func(c *Client) {
+		c.flushEveryN = n
+	}
+}
+
+// WithHistory keeps the "n" most recent metric lines in memory, even after they are flushed,
+// they can be retrieved through the `Client#History`.
+// Note that each line is copied, the history costs memory and allocations, disabled by default.
+func WithHistory(n int) Option {
+	return func(c *Client) {
+		if n > 0 {
+			c.history = newHistory(n)
+		}
+	}
+}
+
+// WithAutoDot ensures that exactly one dot separates a non-empty prefix and the metric names,
+// i.e both "app" and "app." prefixes write "app.my_metric".
+// By default the prefix and the metric name are concatenated as they are.
+func WithAutoDot() Option {
+	return func(c *Client) {
+		c.autoDot = true
+		c.prefix = c.dotPrefix(c.prefix)
+		for i, prefix := range c.additionalPrefixes {
+			c.additionalPrefixes[i] = c.dotPrefix(prefix)
+		}
+	}
+}
+
+// WithAdditionalPrefix writes each metric once more under the "prefix",
+// in addition to the client's prefix, i.e to shadow the production metrics to a canary namespace.
+// It can be used more than once, the `WithAutoDot` applies to the additional prefixes too.
+//
+// Note that each additional prefix duplicates the written lines,
+// the buffer fills and flushes proportionally faster and more packets are sent.
+func WithAdditionalPrefix(prefix string) Option {
+	return func(c *Client) {
+		c.additionalPrefixes = append(c.additionalPrefixes, c.dotPrefix(strings.Replace(prefix, "\n", "_", -1)))
+	}
+}
+
+// WithFloatFormat sets the format and the precision of the float values written by the client,
+// i.e `Client#GaugeFloat64`, see `strconv.FormatFloat` for their meaning.
+// Use 'g' to keep tiny or huge numbers short, i.e 0.0000001 is written as "1e-07".
+// Defaults to the `Float64` value helper, 'f' with the smallest precision necessary.
+func WithFloatFormat(fmt byte, prec int) Option {
+	return func(c *Client) {
+		c.floatFormat = fmt
+		c.floatPrecision = prec
+	}
+}
+
+// WithMinFill makes the `FlushEvery` ticks to skip the flush while the buffered metrics
+// fill less than "ratio" (0-1] of the max packet size, so sparse metrics are sent in fewer, fuller packets.
+// A skipped flush is deferred for up to "maxDefer", then the next tick flushes anyway to bound the latency.
+// Manual `Flush` calls and `Close` always flush everything.
+func WithMinFill(ratio float64, maxDefer time.Duration) Option {
+	return func(c *Client) {
+		c.minFill = ratio
+		c.maxDefer = maxDefer
+	}
+}
+
+// WithSelfMetrics writes the client's own health gauges on each tick of the `FlushEvery`,
+// under the "prefix" instead of the client's prefix, i.e "statsd.client.":
+// "buffered_bytes", the size of the buffer before the flush,
+// "flushes", "packets" and "dropped", see `Client#FlushCount`, `Client#PacketsSent` and `Client#Dropped`.
+func WithSelfMetrics(prefix string) Option {
+	return func(c *Client) {
+		c.selfPrefix = prefix
+	}
+}
+
+// WithMaxNameLength limits the metric names, including the prefix (the longest one of the `WithAdditionalPrefix` too), to "n" bytes,
+// i.e to protect the server from names which embed unbounded data by mistake, like full URLs.
+// Longer names are truncated, the prefix is kept and the end of the name is trimmed, on a character boundary,
+// unless `WithStrict` is used which returns `ErrNameTooLong` instead.
+func WithMaxNameLength(n int) Option {
+	return func(c *Client) {
+		c.maxNameLength = n
+	}
+}
+
+// WithFlushWatchdog reports an `ErrNotFlushed`, through the `Client#OnError` or the standard logger,
+// when the buffer holds metrics for longer than "d" without a flush,
+// i.e when neither `FlushEvery` nor `Flush` are called and nothing is sent until `Close`.
+// It is checked every "d", useful during development. Disabled by default.
+func WithFlushWatchdog(d time.Duration) Option {
+	return func(c *Client) {
+		c.flushWatchdog = d
+	}
+}
+
+// WithWriteTimeout sets a write deadline of "d" before each packet write, so a stuck connection
+// can not block the flush, and all the writers waiting for the client's lock, forever.
+// On timeout the write fails and the metrics are kept in the buffer, see `Client#Flush`.
+// It applies to writers with a `SetWriteDeadline` method, i.e the `net.Conn` of the `UDP` and `TCP`.
+func WithWriteTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.writeTimeout = d
+	}
+}
+
+// WithDelimiters sets the separators of the metric lines for statsd-compatible servers with a different syntax:
+// "nameValue" between the name and the value, "valueType" before the type and the rest of the fields
+// and "rate" the marker of the sample rate, i.e "my_metric:1|c|@0.5" for the defaults ':', '|' and '@'.
+func WithDelimiters(nameValue, valueType, rate byte) Option {
+	return func(c *Client) {
+		c.delimiters = delimiters{nameValue: nameValue, valueType: valueType, rate: rate}
+	}
+}
+
+// WithDuplicateDetection reports a `DuplicateMetricError`, through the `Client#OnError` or the standard logger,
+// when a metric of one of the "types" is written more than once between two flushes of the whole buffer,
+// i.e the same gauge written from two places by mistake, whose last write wins.
+// The "types" default to `Gauge`, duplicate counters and timings are usually expected.
+// It is a debug aid, it costs a map lookup per write. Disabled by default.
+func WithDuplicateDetection(types ...string) Option {
+	return func(c *Client) {
+		if len(types) == 0 {
+			types = []string{Gauge}
+		}
+
+		c.duplicateTypes = types
+		c.seen = make(map[string]struct{})
+	}
+}
+
+// WithEncoding sets the wire format of the packets, i.e `EncodingMsgpack` for the collectors
+// which accept MessagePack frames instead of the line protocol. Defaults to `EncodingText`.
+// The new lines of the `WithFraming` apply only to the `EncodingText`.
+func WithEncoding(encoding Encoding) Option {
+	return func(c *Client) {
+		c.encoding = encoding
+	}
+}
+
+// WithTimerAggregation aggregates the timings of each metric (and tags) client-side, instead of writing every observation,
+// to reduce the volume of the timers on servers which can't handle them at scale.
+// On each flush of the whole buffer (the `FlushEvery` ticks, `Flush(-1)` and `Close`), each aggregated timer is written as four metrics:
+// "name.count" counter with the number of the observations (upscaled by their sample rate)
+// and "name.min", "name.max" and "name.mean" gauges of the durations.
+// The timings with a timestamp, see `WriteMetricAt`, and the ones of the `WriteMetricPrefix` and `WriteMetricRawName`
+// are written as they are, the aggregates are written with the client's prefix and formatter.
+func WithTimerAggregation() Option {
+	return func(c *Client) {
+		c.timers = make(map[string]*timerAggregate)
+	}
+}
+
+// WithAdaptiveSampling samples down the hot counters, timings and histograms so each metric is written
+// about "targetPerSecond" times per second at most. The client measures the write rate of each metric
+// over windows of one second and the writes of the metrics above the target are kept randomly,
+// with the `|@rate` of the kept ones set so the server upscales them back, i.e a counter incremented
+// 1000 times per second with a target of 100 is written ~100 times per second with "|@0.1".
+// The rate of each write is multiplied by the caller's sample rate, if any.
+//
+// The adaptation lags one window behind: a metric is written in full during the first second it gets hot
+// and its rate follows the changes of its volume a second later.
+func WithAdaptiveSampling(targetPerSecond int) Option {
+	return func(c *Client) {
+		if targetPerSecond > 0 {
+			c.sampler = newAdaptiveSampler(targetPerSecond)
+		}
+	}
+}
+
+// WithRawNegativeGauges writes the negative gauge values as they are, without the zero-reset,
+// for the servers which accept negative gauges, i.e the Netdata statsd plugin.
+// It is a shortcut of `WithNegativeGaugeStrategy(NegativeGaugeRaw)`, the default `NegativeGaugeReset`
+// is kept for the compatibility with the etsy statsd.
+func WithRawNegativeGauges() Option {
+	return WithNegativeGaugeStrategy(NegativeGaugeRaw)
+}
+
+// WithDynamicTags adds the tags returned by "fn" to all metrics written by the client, after the `WithGlobalTags`,
+// for the tags which change at runtime, i.e the deployment version or the leader status.
+// The "fn" is called once per flush window, on the first write after each flush of the whole buffer
+// (the `FlushEvery` ticks and `Flush(-1)`), and its tags are reused until the next flush, so it is not called per metric.
+// The "fn" is called under the client's lock, it should not use the client.
+func WithDynamicTags(fn func() []string) Option {
+	return func(c *Client) {
+		c.dynamicTags = fn
+	}
+}
+
+// WithRandSource sets the random source of the client's sampling, see `Client#ShouldSample` and `WithAdaptiveSampling`,
+// i.e a fixed seed for reproducible tests. Defaults to a source seeded with the current time.
+// The source is used under the client's lock, it does not need to be safe for concurrent use.
+func WithRandSource(src rand.Source) Option {
+	return func(c *Client) {
+		if src != nil {
+			c.rng = rand.New(src)
+		}
+	}
+}
+
+// WithSwapFlush writes the whole buffer flushes (the `FlushEvery` ticks and `Flush(-1)`) outside of the client's lock:
+// the buffer is swapped with a spare one under a brief lock and the swapped buffer, owned solely by the flusher,
+// is written while the producers append to the new one, so they are not blocked by a slow writer.
+// The metrics which fail to be written are put back in front of the new buffer and they are retried on the next flush.
+//
+// The writes of the buffer which reaches the max packet size are still done under the lock, by the producer,
+// so the writer should be safe for concurrent writes, i.e the connections of the `UDP` and `TCP`.
+// It does not apply while a `WithRateLimit` is set.
+func WithSwapFlush() Option {
+	return func(c *Client) {
+		c.swapFlush = true
+	}
+}
+
+// WithSetHashing hashes the values of the `Client#UniqueString` to fixed-width tokens by "h", i.e for sets with a huge cardinality
+// of long values, like the unique user agents, so each observation costs a few bytes of the packet.
+// A nil "h" defaults to the 64-bit FNV-1a hash, as 16 hex characters.
+//
+// The server sees the hashed tokens, not the original values, it still counts the unique values correctly
+// as long as the hash has no collisions for them, which is unlikely for a 64-bit hash up to billions of values.
+func WithSetHashing(h func(string) string) Option {
+	return func(c *Client) {
+		if h == nil {
+			h = fnvHash
+		}
+
+		c.setHash = h
+	}
+}
@@ -0,0 +1,299 @@
+package statsd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// summaryQuantiles are the quantiles written for the timing and histogram metrics by the `PushgatewayWriter`.
+var summaryQuantiles = []float64{0.5, 0.9, 0.99}
+
+type promKey struct {
+	name   string
+	labels string // rendered, i.e `env="dev",method="GET"`.
+}
+
+type promSummary struct {
+	sum    float64
+	count  float64
+	window []float64 // the observations since the last successful push.
+}
+
+type pushgatewayWriter struct {
+	url    string
+	client *http.Client
+
+	mu        sync.Mutex
+	counters  map[promKey]float64
+	gauges    map[promKey]float64
+	summaries map[promKey]*promSummary
+	dirty     bool
+}
+
+// PushgatewayWriter returns an `io.WriteCloser` which translates the flushed metrics
+// to the Prometheus exposition format and pushes them to the Prometheus Pushgateway at "gatewayURL",
+// under the "job" grouping key, on each client's flush and on `Close`.
+//
+// Counters are accumulated (and upscaled by their sample rate), gauges keep their last value
+// and timings and histograms are converted to summaries with their sum, count and 0.5, 0.9, 0.99 quantiles
+// of the observations since the previous push. Sets are not supported and they are skipped.
+// The metric names are sanitized to valid Prometheus names and the Datadog style tags (see `TagStyleDatadog`) become labels.
+//
+// Useful to migrate to Prometheus without touching the call sites of the client.
+//
+// Usage:
+// NewClient(PushgatewayWriter("http://pushgateway:9091", "my_job"), "my_prefix_")
+func PushgatewayWriter(gatewayURL, job string) io.WriteCloser {
+	return &pushgatewayWriter{
+		url:       strings.TrimSuffix(gatewayURL, "/") + "/metrics/job/" + url.PathEscape(job),
+		client:    http.DefaultClient,
+		counters:  make(map[promKey]float64),
+		gauges:    make(map[promKey]float64),
+		summaries: make(map[promKey]*promSummary),
+	}
+}
+
+func (w *pushgatewayWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	for _, line := range strings.Split(string(b), "\n") {
+		w.add(line)
+	}
+	w.mu.Unlock()
+
+	return len(b), nil
+}
+
+// add parses a "name:value[:value...]|type[|@rate][|#tags]" metric line, invalid lines are skipped.
+func (w *pushgatewayWriter) add(line string) {
+	sep := strings.IndexByte(line, ':')
+	if sep <= 0 {
+		return
+	}
+
+	fields := strings.Split(line[sep+1:], "|")
+	if len(fields) < 2 {
+		return
+	}
+
+	rate, tags := 1.0, ""
+	for _, field := range fields[2:] {
+		switch {
+		case strings.HasPrefix(field, "@"):
+			if r, err := strconv.ParseFloat(field[1:], 64); err == nil && r > 0 {
+				rate = r
+			}
+		case strings.HasPrefix(field, "#"):
+			tags = field[1:]
+		}
+	}
+
+	key := promKey{name: promName(line[:sep]), labels: promLabels(tags)}
+
+	for _, value := range strings.Split(fields[0], ":") {
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			continue
+		}
+
+		switch fields[1] {
+		case Count:
+			w.counters[key] += v / rate
+		case Gauge:
+			if value[0] == '+' || value[0] == '-' {
+				w.gauges[key] += v
+			} else {
+				w.gauges[key] = v
+			}
+		case Time, Histogram:
+			s, ok := w.summaries[key]
+			if !ok {
+				s = new(promSummary)
+				w.summaries[key] = s
+			}
+			s.sum += v
+			s.count += 1 / rate
+			s.window = append(s.window, v)
+		default:
+			continue
+		}
+
+		w.dirty = true
+	}
+}
+
+// Flush pushes the metrics, if any changed since the last push.
+// On failure the metrics are kept for the next `Flush`.
+func (w *pushgatewayWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.dirty {
+		return nil
+	}
+
+	req, err := http.NewRequest(http.MethodPut, w.url, bytes.NewReader(w.render()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("statsd: pushgateway: unexpected status code %d", resp.StatusCode)
+	}
+
+	for _, s := range w.summaries {
+		s.window = s.window[:0]
+	}
+	w.dirty = false
+	return nil
+}
+
+func (w *pushgatewayWriter) Close() error {
+	return w.Flush()
+}
+
+// render writes all the metrics in the Prometheus text exposition format, sorted by name and labels.
+func (w *pushgatewayWriter) render() []byte {
+	var buf bytes.Buffer
+
+	keys := sortedPromKeys(w.counters)
+	for i, key := range keys {
+		writePromType(&buf, keys, i, "counter")
+		writePromSample(&buf, key.name, key.labels, w.counters[key])
+	}
+
+	keys = sortedPromKeys(w.gauges)
+	for i, key := range keys {
+		writePromType(&buf, keys, i, "gauge")
+		writePromSample(&buf, key.name, key.labels, w.gauges[key])
+	}
+
+	keys = make([]promKey, 0, len(w.summaries))
+	for key := range w.summaries {
+		keys = append(keys, key)
+	}
+	sortPromKeys(keys)
+
+	for i, key := range keys {
+		s := w.summaries[key]
+		writePromType(&buf, keys, i, "summary")
+
+		if len(s.window) > 0 {
+			sort.Float64s(s.window)
+			for _, q := range summaryQuantiles {
+				labels := `quantile="` + strconv.FormatFloat(q, 'f', -1, 64) + `"`
+				if key.labels != "" {
+					labels = key.labels + "," + labels
+				}
+				writePromSample(&buf, key.name, labels, quantile(s.window, q))
+			}
+		}
+
+		writePromSample(&buf, key.name+"_sum", key.labels, s.sum)
+		writePromSample(&buf, key.name+"_count", key.labels, s.count)
+	}
+
+	return buf.Bytes()
+}
+
+func sortedPromKeys(m map[promKey]float64) []promKey {
+	keys := make([]promKey, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sortPromKeys(keys)
+
+	return keys
+}
+
+func sortPromKeys(keys []promKey) {
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].name != keys[j].name {
+			return keys[i].name < keys[j].name
+		}
+		return keys[i].labels < keys[j].labels
+	})
+}
+
+// writePromType writes the TYPE line of the "i" key, once per metric name as the keys are sorted by name.
+func writePromType(buf *bytes.Buffer, keys []promKey, i int, typ string) {
+	if i > 0 && keys[i-1].name == keys[i].name {
+		return
+	}
+
+	buf.WriteString("# TYPE " + keys[i].name + " " + typ + "\n")
+}
+
+func writePromSample(buf *bytes.Buffer, name, labels string, v float64) {
+	buf.WriteString(name)
+	if labels != "" {
+		buf.WriteByte('{')
+		buf.WriteString(labels)
+		buf.WriteByte('}')
+	}
+	buf.WriteByte(' ')
+	buf.WriteString(strconv.FormatFloat(v, 'g', -1, 64))
+	buf.WriteByte('\n')
+}
+
+// quantile returns the nearest-rank "q" quantile of the sorted "values".
+func quantile(values []float64, q float64) float64 {
+	i := int(math.Ceil(q*float64(len(values)))) - 1
+	if i < 0 {
+		i = 0
+	}
+
+	return values[i]
+}
+
+// promName replaces the characters which are not valid in a Prometheus metric name with underscores.
+func promName(name string) string {
+	b := []byte(name)
+	for i, c := range b {
+		if !(c == '_' || c == ':' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 0 && c >= '0' && c <= '9') {
+			b[i] = '_'
+		}
+	}
+
+	return string(b)
+}
+
+var promLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// promLabels converts the "key:value,key2:value2" tags to sorted Prometheus labels,
+// tags without a value are skipped.
+func promLabels(tags string) string {
+	if tags == "" {
+		return ""
+	}
+
+	var labels []string
+	for _, tag := range strings.Split(tags, ",") {
+		sep := strings.IndexByte(tag, ':')
+		if sep <= 0 {
+			continue
+		}
+
+		name := strings.Replace(promName(tag[:sep]), ":", "_", -1)
+		labels = append(labels, name+`="`+promLabelEscaper.Replace(tag[sep+1:])+`"`)
+	}
+	sort.Strings(labels)
+
+	return strings.Join(labels, ",")
+}
@@ -0,0 +1,78 @@
+package statsd
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPushgatewayWriter(t *testing.T) {
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			t.Errorf("expected PUT request but got %s", r.Method)
+		}
+
+		if expected, got := "/metrics/job/my_job", r.URL.Path; expected != got {
+			t.Errorf("expected path [%s] but got [%s]", expected, got)
+		}
+
+		b, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+	}))
+	defer srv.Close()
+
+	client := NewClient(PushgatewayWriter(srv.URL+"/", "my_job"), "my_prefix.")
+	client.Increment("my_counter")
+	client.WriteMetric("my_counter", "1", Count, 0.5)
+	client.Gauge("my_gauge", -2)
+	client.TimeTags("my_timer", 10*time.Millisecond, "method:GET")
+	client.WriteMetricMulti("my_timer", []string{"30", "20"}, Time, 1)
+	client.Unique("my_set", 1)
+	client.Flush(-1)
+
+	// nothing changed, no push.
+	client.Flush(-1)
+
+	client.Increment("my_counter")
+	client.Close()
+
+	expected := []string{
+		"# TYPE my_prefix_my_counter counter\n" +
+			"my_prefix_my_counter 3\n" +
+			"# TYPE my_prefix_my_gauge gauge\n" +
+			"my_prefix_my_gauge -2\n" +
+			"# TYPE my_prefix_my_timer summary\n" +
+			"my_prefix_my_timer{quantile=\"0.5\"} 20\n" +
+			"my_prefix_my_timer{quantile=\"0.9\"} 30\n" +
+			"my_prefix_my_timer{quantile=\"0.99\"} 30\n" +
+			"my_prefix_my_timer_sum 50\n" +
+			"my_prefix_my_timer_count 2\n" +
+			"my_prefix_my_timer{method=\"GET\",quantile=\"0.5\"} 10\n" +
+			"my_prefix_my_timer{method=\"GET\",quantile=\"0.9\"} 10\n" +
+			"my_prefix_my_timer{method=\"GET\",quantile=\"0.99\"} 10\n" +
+			"my_prefix_my_timer_sum{method=\"GET\"} 10\n" +
+			"my_prefix_my_timer_count{method=\"GET\"} 1\n",
+		"# TYPE my_prefix_my_counter counter\n" +
+			"my_prefix_my_counter 4\n" +
+			"# TYPE my_prefix_my_gauge gauge\n" +
+			"my_prefix_my_gauge -2\n" +
+			"# TYPE my_prefix_my_timer summary\n" +
+			"my_prefix_my_timer_sum 50\n" +
+			"my_prefix_my_timer_count 2\n" +
+			"my_prefix_my_timer_sum{method=\"GET\"} 10\n" +
+			"my_prefix_my_timer_count{method=\"GET\"} 1\n",
+	}
+
+	if len(bodies) != len(expected) {
+		t.Fatalf("expected %d requests but got %d: %q", len(expected), len(bodies), bodies)
+	}
+
+	for i := range expected {
+		if expected[i] != bodies[i] {
+			t.Fatalf("[%d] expected body:\n%s\nbut got:\n%s", i, expected[i], bodies[i])
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package statsd
+
+import "time"
+
+// tokenBucket is a simple, not thread-safe, token bucket rate limiter.
+// Its capacity is the number of tokens (i.e packets) per second.
+type tokenBucket struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(perSec int) *tokenBucket {
+	return &tokenBucket{rate: float64(perSec), tokens: float64(perSec)}
+}
+
+// allow reports whether a token is available at "now" and takes it.
+func (b *tokenBucket) allow(now time.Time) bool {
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.rate {
+			b.tokens = b.rate
+		}
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+	return true
+}
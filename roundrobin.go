@@ -0,0 +1,188 @@
+package statsd
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// DefaultResolveInterval is the default interval of the DNS re-resolution of the `UDPRoundRobin` writer.
+const DefaultResolveInterval = 30 * time.Second
+
+var (
+	errNoAddrs          = errors.New("statsd: no addresses resolved")
+	errRoundRobinClosed = errors.New("statsd: round-robin writer is closed")
+)
+
+// roundRobinUDP writes each datagram to the next one of the resolved addresses of a hostname.
+type roundRobinUDP struct {
+	host, port   string
+	resolveEvery time.Duration
+
+	// replaced by tests.
+	lookup func(host string) ([]string, error)
+	dial   func(addr string) (io.WriteCloser, error)
+	now    func() time.Time
+
+	mu         sync.Mutex
+	ips        []string
+	conns      []io.WriteCloser // one per "ips".
+	next       int
+	resolvedAt time.Time
+	closed     bool // no re-resolution after the `Close`, it would dial new connections.
+}
+
+// UDPRoundRobin same as `UDP` but it resolves all the IP addresses of the "addr"'s hostname,
+// i.e a cluster of statsd servers behind a DNS name with multiple A records,
+// and writes each packet to the next one of them, in a round-robin fashion.
+//
+// The hostname is re-resolved on the first write after every "resolveEvery" interval, `DefaultResolveInterval` if not positive,
+// so the writer follows the DNS changes. If the re-resolution fails the previous addresses are kept.
+//
+// Usage:
+// conn, _ := UDPRoundRobin("statsd.cluster.local:8125", time.Minute)
+// NewClient(conn, "my_prefix.")
+func UDPRoundRobin(addr string, resolveEvery time.Duration) (io.WriteCloser, error) {
+	if addr == "" {
+		addr = ":8125"
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if resolveEvery <= 0 {
+		resolveEvery = DefaultResolveInterval
+	}
+
+	w := &roundRobinUDP{
+		host:         host,
+		port:         port,
+		resolveEvery: resolveEvery,
+		lookup:       lookupHost,
+		dial: func(addr string) (io.WriteCloser, error) {
+			return net.Dial("udp", addr)
+		},
+		now: time.Now,
+	}
+
+	if err = w.resolve(); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+func lookupHost(host string) ([]string, error) {
+	if host == "" {
+		return []string{""}, nil // the local system, like the `UDP`.
+	}
+
+	return net.LookupHost(host)
+}
+
+// resolve looks up the addresses of the host and dials the new ones,
+// the connections of the addresses which are gone are closed. The previous connections are kept on failure.
+func (w *roundRobinUDP) resolve() error {
+	w.resolvedAt = w.now()
+
+	ips, err := w.lookup(w.host)
+	if err != nil {
+		return err
+	}
+
+	ips = uniqueStrings(ips)
+	if len(ips) == 0 {
+		return errNoAddrs
+	}
+
+	old := make(map[string]io.WriteCloser, len(w.ips))
+	for i, ip := range w.ips {
+		old[ip] = w.conns[i]
+	}
+
+	var dialed []io.WriteCloser
+	conns := make([]io.WriteCloser, 0, len(ips))
+	for _, ip := range ips {
+		conn, ok := old[ip]
+		if !ok {
+			if conn, err = w.dial(net.JoinHostPort(ip, w.port)); err != nil {
+				for _, conn := range dialed {
+					conn.Close()
+				}
+				return err
+			}
+			dialed = append(dialed, conn)
+		}
+
+		conns = append(conns, conn)
+	}
+
+	for _, ip := range ips {
+		delete(old, ip)
+	}
+
+	for _, conn := range old {
+		conn.Close()
+	}
+
+	w.ips, w.conns = ips, conns
+	return nil
+}
+
+func uniqueStrings(values []string) []string {
+	unique := values[:0:0]
+	seen := make(map[string]bool, len(values))
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			unique = append(unique, v)
+		}
+	}
+
+	return unique
+}
+
+// Write writes "b" to the next connection, the lock is held during the write
+// so a concurrent re-resolution does not close the connection in use.
+func (w *roundRobinUDP) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return 0, errRoundRobinClosed
+	}
+
+	if w.now().Sub(w.resolvedAt) >= w.resolveEvery {
+		w.resolve() // on failure the previous addresses are used.
+	}
+
+	if len(w.conns) == 0 {
+		return 0, errNoAddrs
+	}
+
+	conn := w.conns[w.next%len(w.conns)]
+	w.next++
+
+	return conn.Write(b)
+}
+
+func (w *roundRobinUDP) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.closed = true
+
+	var err error
+	for _, conn := range w.conns {
+		if cerr := conn.Close(); err == nil {
+			err = cerr
+		}
+	}
+	w.ips, w.conns = nil, nil
+
+	return err
+}
@@ -0,0 +1,113 @@
+package statsd
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestUDPRoundRobin(t *testing.T) {
+	clock := newFakeClock()
+	ips := []string{"10.0.0.1", "10.0.0.2"}
+	conns := make(map[string]*ClosingBuffer)
+	closed := make(map[string]bool)
+
+	w := &roundRobinUDP{
+		port:         "8125",
+		resolveEvery: time.Minute,
+		lookup:       func(string) ([]string, error) { return ips, nil },
+		dial: func(addr string) (io.WriteCloser, error) {
+			conn := &ClosingBuffer{new(bytes.Buffer)}
+			conns[addr] = conn
+			return closeRecorder{conn, func() { closed[addr] = true }}, nil
+		},
+		now: clock.Now,
+	}
+	if err := w.resolve(); err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewClient(w, "")
+	for _, name := range []string{"a", "b", "c"} {
+		client.Increment(name)
+		client.Flush(-1)
+	}
+
+	if got := conns["10.0.0.1:8125"].String(); got != "a:1|cc:1|c" {
+		t.Fatalf("expected the first and third packets on the first address but got [%s]", got)
+	}
+	if got := conns["10.0.0.2:8125"].String(); got != "b:1|c" {
+		t.Fatalf("expected the second packet on the second address but got [%s]", got)
+	}
+
+	// the address which is gone is closed, the one which is kept is reused.
+	ips = []string{"10.0.0.2", "10.0.0.3"}
+	clock.Advance(time.Minute)
+	client.Increment("d")
+	client.Flush(-1)
+
+	if !closed["10.0.0.1:8125"] || closed["10.0.0.2:8125"] {
+		t.Fatalf("expected only the removed address to be closed but got %v", closed)
+	}
+	if got := conns["10.0.0.2:8125"].String(); got != "b:1|c" {
+		t.Fatalf("expected no new packet on the second address but got [%s]", got)
+	}
+	if got := conns["10.0.0.3:8125"].String(); got != "d:1|c" {
+		t.Fatalf("expected the packet on the new address but got [%s]", got)
+	}
+
+	client.Close()
+	if !closed["10.0.0.2:8125"] || !closed["10.0.0.3:8125"] {
+		t.Fatalf("expected all the connections to be closed but got %v", closed)
+	}
+
+	// a closed writer is not re-resolved, no new connection is dialed.
+	dialed := len(conns)
+	clock.Advance(time.Minute)
+	if _, err := w.Write([]byte("e:1|c")); err != errRoundRobinClosed {
+		t.Fatalf("expected errRoundRobinClosed but got %v", err)
+	}
+	if len(conns) != dialed {
+		t.Fatalf("expected no connection to be dialed after the close but got %d", len(conns)-dialed)
+	}
+}
+
+func TestUDPRoundRobinDial(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	conn, err := UDPRoundRobin(server.LocalAddr().String(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewClient(conn, "")
+	client.Increment("my_metric")
+	client.Close()
+
+	b := make([]byte, 64)
+	server.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := server.ReadFrom(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := "my_metric:1|c", string(b[:n]); expected != got {
+		t.Fatalf("expected [%s] but got [%s]", expected, got)
+	}
+}
+
+type closeRecorder struct {
+	io.Writer
+	close func()
+}
+
+func (c closeRecorder) Close() error {
+	c.close()
+	return nil
+}
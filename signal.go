@@ -0,0 +1,82 @@
+package statsd
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// FlushOnSignals flushes the buffered metrics when the process receives one of the "sigs",
+// defaults to the `os.Interrupt` and `syscall.SIGTERM`, so the last metrics are not lost on a shutdown
+// by an app which forgets to `Close` the client.
+//
+// The signals are not consumed: each `signal.Notify` channel receives a copy of them, the app's handlers still do.
+// Note that, like any `signal.Notify`, it disables the default action of the signals, the process is not terminated
+// by them anymore, so it fits apps which handle the signals themselves, see `CloseOnSignals` for the rest.
+// The returned "stop" function uninstalls the handler, it is uninstalled on `Close` too.
+func (c *Client) FlushOnSignals(sigs ...os.Signal) (stop func()) {
+	return c.onSignals(false, sigs)
+}
+
+// CloseOnSignals same as `FlushOnSignals` but it closes the client on the first of the "sigs"
+// and then it uninstalls the handler and re-raises the signal, so the default action of the signal,
+// i.e the termination of the process, still takes place for apps which don't handle the signals.
+// An app which handles the signals receives the signal twice, use the `FlushOnSignals` instead.
+func (c *Client) CloseOnSignals(sigs ...os.Signal) (stop func()) {
+	return c.onSignals(true, sigs)
+}
+
+func (c *Client) onSignals(closeClient bool, sigs []os.Signal) (stop func()) {
+	if c.disabled() || c.IsClosed() {
+		return func() {}
+	}
+
+	if len(sigs) == 0 {
+		sigs = []os.Signal{os.Interrupt, syscall.SIGTERM} // an empty list would notify all the signals.
+	}
+
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+
+	quit := make(chan struct{})
+	var once sync.Once
+	stop = func() {
+		once.Do(func() {
+			signal.Stop(ch)
+			close(quit)
+		})
+	}
+
+	go func() {
+		for {
+			select {
+			case sig := <-ch:
+				if closeClient {
+					stop()
+					c.Close()
+					raise(sig)
+					return
+				}
+
+				if err := c.Flush(-1); err != ErrClosed {
+					c.reportError(err)
+				}
+			case <-c.done:
+				stop()
+				return
+			case <-quit:
+				return
+			}
+		}
+	}()
+
+	return stop
+}
+
+// raise sends "sig" to the current process.
+func raise(sig os.Signal) {
+	if p, err := os.FindProcess(os.Getpid()); err == nil {
+		p.Signal(sig)
+	}
+}
@@ -0,0 +1,87 @@
+package statsd
+
+import (
+	"bytes"
+	"os"
+	"os/signal"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestClientFlushOnSignals(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("signals can not be sent to the current process")
+	}
+
+	// the app's own handler, it receives the signals too.
+	app := make(chan os.Signal, 2)
+	signal.Notify(app, os.Interrupt)
+	defer signal.Stop(app)
+
+	flushed := make(chan string, 1)
+	client := NewClientWriter(new(bytes.Buffer), "")
+	client.OnFlush(func(payload []byte) { flushed <- string(payload) })
+	stop := client.FlushOnSignals(os.Interrupt)
+	defer stop()
+
+	client.Increment("my_metric")
+	raise(os.Interrupt)
+
+	select {
+	case got := <-flushed:
+		if expected := "my_metric:1|c"; expected != got {
+			t.Fatalf("expected [%s] but got [%s]", expected, got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the metrics to be flushed on the signal")
+	}
+
+	select {
+	case <-app:
+	case <-time.After(time.Second):
+		t.Fatal("expected the signal to reach the app's handler too")
+	}
+
+	stop()
+	client.Close()
+}
+
+func TestClientCloseOnSignals(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("signals can not be sent to the current process")
+	}
+
+	app := make(chan os.Signal, 2)
+	signal.Notify(app, os.Interrupt) // keeps the re-raised signal from terminating the test.
+	defer signal.Stop(app)
+
+	flushed := make(chan string, 1)
+	client := NewClientWriter(new(bytes.Buffer), "")
+	client.OnFlush(func(payload []byte) { flushed <- string(payload) })
+	client.CloseOnSignals(os.Interrupt)
+
+	client.Increment("my_metric")
+	raise(os.Interrupt)
+
+	for i := 0; i < 2; i++ { // the signal and its re-raise.
+		select {
+		case <-app:
+		case <-time.After(time.Second):
+			t.Fatalf("expected the signal %d to reach the app's handler", i)
+		}
+	}
+
+	if !client.IsClosed() {
+		t.Fatal("expected the client to be closed on the signal")
+	}
+
+	select {
+	case got := <-flushed:
+		if expected := "my_metric:1|c"; expected != got {
+			t.Fatalf("expected [%s] but got [%s]", expected, got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the metrics to be flushed on close")
+	}
+}
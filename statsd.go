@@ -2,40 +2,75 @@
 package statsd
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"hash/fnv"
 	"io"
+	"io/ioutil"
+	"log"
+	"math/rand"
 	"net"
+	"os"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
+	"unicode/utf8"
 )
 
+// MetricType is a statsd metric type, see `Client#WriteMetricTyped`.
+// The metric type constants are untyped so they can be passed to both the `MetricType`
+// and the plain string based methods, i.e `Client#WriteMetric`.
+type MetricType string
+
 const (
 	// Count is the "c" Counting statsd metric type.
-	Count string = "c"
+	Count = "c"
 
 	// Gauge is the "g" Gauges statsd metric type.
-	Gauge string = "g"
+	Gauge = "g"
 
 	// Unique is the "s" Sets statsd metric type.
-	Unique string = "s"
+	Unique = "s"
 
 	// Set is an alias for `Unique`.
 	Set = Unique
 
 	// Time is the "ms" Timing statsd metric type.
-	Time string = "ms"
+	Time = "ms"
 
 	// Histogram is the "h" statsd metric type,
 	// difference from `Time` metric type is that `Time` writes milleseconds.
 	// Read more at: https://docs.netdata.cloud/collectors/statsd.plugin/
-	Histogram string = "h"
+	Histogram = "h"
 )
 
+// IsValid reports whether "t" is one of the known metric types,
+// i.e `Count`, `Gauge`, `Unique`, `Time` or `Histogram`.
+func (t MetricType) IsValid() bool {
+	switch t {
+	case Count, Gauge, Unique, Time, Histogram:
+		return true
+	default:
+		return false
+	}
+}
+
 var (
 	// Duration accepts a duration and returns a string of the duration's millesecond.
 	Duration = func(v time.Duration) string { return Int(int(v / time.Millisecond)) }
 
+	// DurationMicro accepts a duration and returns a string of the duration's millesecond
+	// with microsecond precision, i.e "0.3" for 300µs.
+	// Note that the unit is still the millesecond, so it can be mixed with the `Duration` values
+	// of the same metric, but the statsd server should accept decimal timing values.
+	DurationMicro = func(v time.Duration) string { return Float64(float64(v/time.Microsecond) / 1000) }
+
 	// Int accepts an int and returns its string form.
 	Int = func(v int) string { return Int64(int64(v)) }
 
@@ -73,21 +108,113 @@ var (
 	Float64 = func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
 )
 
+var (
+	// ErrClosed is returned by the `Client` methods when the client is already closed.
+	ErrClosed = errors.New("statsd: client is closed")
+	// ErrInvalidRate is returned by the `Client#WriteMetric` on `WithStrict` mode
+	// when the sample rate is negative or greater than 1, a zero rate is the optional rate 1.
+	ErrInvalidRate = errors.New("statsd: sample rate is out of range")
+	// ErrNameTooLong is returned by the `Client#WriteMetric` on `WithStrict` mode
+	// when the metric name is longer than the `WithMaxNameLength`.
+	ErrNameTooLong = errors.New("statsd: metric name is too long")
+	// ErrNewline is returned by the `Client#WriteMetric` on `WithStrict` mode
+	// when the metric name, prefix, value or one of its tags contains a new line, otherwise new lines are replaced with underscores.
+	ErrNewline = errors.New("statsd: metric name, prefix, value or tag contains a new line")
+	// ErrNotFlushed is reported by the `WithFlushWatchdog` when the buffered metrics are not flushed for too long.
+	ErrNotFlushed = errors.New("statsd: buffered metrics are not flushed, see FlushEvery and Flush")
+	// ErrInvalidType is returned by the `Client#WriteMetricTyped` when the metric type is not a known one.
+	ErrInvalidType = errors.New("statsd: unknown metric type")
+)
+
 // Client implements the StatsD Client.
+// All of its methods are safe to call on a nil `*Client`, they do nothing and return nil,
+// so an optional client can be kept without nil guards, see `NewNoopClient` too.
 type Client struct {
 	w                   io.WriteCloser
 	prefix              string
 	metricNameFormatter func(metricName string) string
 	maxPacketSize       int
 
-	// we could use something like that to both `Stop` the ticker (to avoid any leaks),
-	// if `FlushEvery` on client connection `Close`.
-	// closed        chan struct{}
-	closed uint32
-
-	buf         []byte
-	mu          sync.Mutex   // mutex for `buf` and `flushTicker`.
-	flushTicker *time.Ticker // it's a variable in order to be re-used so `EveryFlush` can be called to change the Flush duration.
+	closed uint32        // atomic, see `IsClosed`.
+	noop   bool          // see `NewNoopClient`.
+	done   chan struct{} // closed on `Close`, see `RecordUntil`.
+
+	buf       []byte
+	mu        sync.Mutex // mutex for `buf` and `flushLoop`.
+	flushLoop *flushLoop // it's a variable in order to be replaced so `EveryFlush` can be called to change the Flush duration.
+
+	clock      Clock              // see `WithClock`.
+	framing    FramingMode        // see `WithFraming`.
+	tagStyle   TagStyle           // see `WithTagStyle`.
+	delimiters delimiters         // see `WithDelimiters`.
+	encoding   Encoding           // see `WithEncoding`.
+	encoded    []byte             // the reused buffer of the encoded packets, see `WithEncoding`.
+	tags       []string           // see `WithGlobalTags`.
+	rates      map[string]float32 // see `WithDefaultRate`.
+
+	negativeGauges NegativeGaugeStrategy // see `WithNegativeGaugeStrategy`.
+	strict         bool                  // see `WithStrict`.
+	autoDot        bool                  // see `WithAutoDot`.
+
+	additionalPrefixes []string // see `WithAdditionalPrefix`.
+	floatFormat        byte     // see `WithFloatFormat`.
+	floatPrecision     int      // see `WithFloatFormat`.
+
+	limiter       *tokenBucket // see `WithRateLimit`.
+	maxBufferSize int          // see `WithMaxBufferBytes`.
+	flushEveryN   int          // see `WithFlushEveryN`.
+	pending       int          // the number of buffered metrics, if `flushEveryN` > 0.
+
+	minFill       float64       // see `WithMinFill`.
+	maxDefer      time.Duration // see `WithMinFill`.
+	deferredSince time.Time     // the time of the first skipped tick, see `deferFlush`.
+	selfPrefix    string        // see `WithSelfMetrics`.
+	maxNameLength int           // see `WithMaxNameLength`.
+	flushWatchdog time.Duration // see `WithFlushWatchdog`.
+	writeTimeout  time.Duration // see `WithWriteTimeout`.
+
+	duplicateTypes []string            // see `WithDuplicateDetection`.
+	seen           map[string]struct{} // the tracked metrics of the current flush window.
+	watchdogSince  time.Time           // the time the buffer became non-empty or it was last flushed.
+
+	timers    map[string]*timerAggregate // see `WithTimerAggregation`.
+	timerKeys []string                   // the keys of the "timers" in the order of their first observation.
+	timerKey  []byte                     // the scratch of the "timers" lookups, see `aggregateTimer`.
+	sampler   *adaptiveSampler           // see `WithAdaptiveSampling`.
+	rng       *rand.Rand                 // see `WithRandSource`, created on first use.
+	setHash   func(string) string        // see `WithSetHashing`.
+
+	swapFlush   bool       // see `WithSwapFlush`.
+	swapMu      sync.Mutex // held by the swapped flushes, before the "mu", so only one of them writes at a time.
+	spare       []byte     // the spare buffer of the swapped flushes.
+	swapEncoded []byte     // the reused buffer of the encoded packets of the swapped flushes.
+
+	counters    map[string]float64 // see `Accumulate`.
+	counterKeys []string           // the keys of the "counters" in the order of their first delta.
+
+	dynamicTags  func() []string // see `WithDynamicTags`.
+	dynamic      []string        // the global and the dynamic tags of the current flush window.
+	dynamicFresh bool            // reports whether the "dynamic" tags are evaluated in the current flush window.
+
+	gauges     []registeredGauge // see `RegisterGauge`, copy-on-write.
+	history    *history          // see `WithHistory`.
+	beforeTick func()            // the ticks of the group's clients, see `Group#FlushEvery`.
+	group      *Client           // the client which owns the group's buffer, see `Group#Client`.
+
+	onFlush func(payload []byte) // see `OnFlush`.
+	onError func(err error)      // see `OnError`.
+	errs    []error              // passed to `onError`, or logged, on `unlock`.
+
+	onFlushStats func(stats FlushStats) // see `OnFlushStats`.
+	flushStats   []FlushStats           // passed to `onFlushStats` on `unlock`.
+	stats        *FlushStats            // the statistics of the current flush, if `onFlushStats` is set.
+	flushed      []*[]byte              // pooled copies of the flushed packets, passed to `onFlush` on `unlock`.
+
+	// atomic counters.
+	dropped  uint64 // see `Dropped`.
+	deferred uint64 // see `Deferred`.
+	flushes  uint64 // see `FlushCount`.
+	packets  uint64 // see `PacketsSent`.
 }
 
 const defaultMaxPacketSize = 1500
@@ -99,6 +226,54 @@ const defaultMaxPacketSize = 1500
 // conn, _ := UDP(":8125")
 // NewClient(conn, "my_prefix.")
 func UDP(addr string) (io.WriteCloser, error) {
+	conn, err := dialUDP(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// MustUDP same as `UDP` but it panics on error,
+// for the `main` or `init` functions where the failure is fatal anyway.
+//
+// Usage:
+// client := NewClient(MustUDP(":8125"), "my_prefix.")
+func MustUDP(addr string) io.WriteCloser {
+	conn, err := UDP(addr)
+	if err != nil {
+		panic(err)
+	}
+
+	return conn
+}
+
+// UDPWithBufferSize same as `UDP` but it sets the size of the kernel's send buffer
+// of the UDP connection to "sndbuf" bytes.
+//
+// A bigger send buffer gives more tolerance to bursts of flushes,
+// it does not change the size of each packet, that is controlled by the `SetMaxPackageSize`.
+// Note that a `SetMaxPackageSize` value greater than the path MTU will cause fragmentation
+// no matter how big the send buffer is.
+//
+// Usage:
+// conn, _ := UDPWithBufferSize(":8125", 1<<20)
+// NewClient(conn, "my_prefix.")
+func UDPWithBufferSize(addr string, sndbuf int) (io.WriteCloser, error) {
+	conn, err := dialUDP(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = conn.SetWriteBuffer(sndbuf); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+func dialUDP(addr string) (*net.UDPConn, error) {
 	if addr == "" {
 		addr = ":8125"
 	}
@@ -108,7 +283,56 @@ func UDP(addr string) (io.WriteCloser, error) {
 		return nil, err
 	}
 
-	conn, err := net.DialUDP("udp", nil, raddr)
+	return net.DialUDP("udp", nil, raddr)
+}
+
+// Dialer is a function which establishes a network connection, i.e `net.Dial`,
+// see `UDPWithDialer` and `TCPWithDialer`.
+type Dialer func(network, addr string) (net.Conn, error)
+
+// UDPWithDialer same as `UDP` but the connection is established by "dial",
+// i.e through a proxy or an in-memory pipe for tests. A nil "dial" defaults to `net.Dial`.
+func UDPWithDialer(addr string, dial Dialer) (io.WriteCloser, error) {
+	return dialWith("udp", addr, dial)
+}
+
+// TCP returns an `io.WriteCloser` from a `TCP` connection.
+// The "addr" should be the full TCP address of form: HOST:PORT.
+//
+// TCP is a byte-stream transport, the client should be created with the `WithFraming(FramingStream)`.
+// Usage:
+// conn, _ := TCP(":8125")
+// NewClient(conn, "my_prefix.", WithFraming(FramingStream))
+func TCP(addr string) (io.WriteCloser, error) {
+	return dialWith("tcp", addr, nil)
+}
+
+// MustTCP same as `TCP` but it panics on error, see `MustUDP`.
+func MustTCP(addr string) io.WriteCloser {
+	conn, err := TCP(addr)
+	if err != nil {
+		panic(err)
+	}
+
+	return conn
+}
+
+// TCPWithDialer same as `TCP` but the connection is established by "dial",
+// a nil "dial" defaults to `net.Dial`.
+func TCPWithDialer(addr string, dial Dialer) (io.WriteCloser, error) {
+	return dialWith("tcp", addr, dial)
+}
+
+func dialWith(network, addr string, dial Dialer) (io.WriteCloser, error) {
+	if addr == "" {
+		addr = ":8125"
+	}
+
+	if dial == nil {
+		dial = net.Dial
+	}
+
+	conn, err := dial(network, addr)
 	if err != nil {
 		return nil, err
 	}
@@ -120,6 +344,8 @@ func UDP(addr string) (io.WriteCloser, error) {
 // The first input argument, "writeCloser", should be a value which completes the `io.WriteCloser`
 // interface. It can be a UDP connection or a string buffer or even the stdout for testing.
 //
+// A nil "writeCloser" is treated as a sink which discards all the metrics, instead of panicking on the first flush.
+//
 // The second input argument, "prefix" can be empty but it is usually the app's name + '.'.
 //
 // Example:
@@ -132,14 +358,54 @@ func UDP(addr string) (io.WriteCloser, error) {
 // err := client.WriteMetric("my_metric", Int(1), Count, 0.5)
 // ^ increment by one, sample rate at 0.5
 //
+// The last variadic input argument, "opts", can be used to customize the client, see the `Option` type.
+//
 // Read more at: https://github.com/etsy/statsd/blob/master/docs/metric_types.md
-func NewClient(writeCloser io.WriteCloser, prefix string) *Client {
-	c := &Client{w: writeCloser, prefix: prefix}
+func NewClient(writeCloser io.WriteCloser, prefix string, opts ...Option) *Client {
+	if writeCloser == nil {
+		writeCloser = nopCloser{ioutil.Discard}
+	}
+
+	prefix = strings.Replace(prefix, "\n", "_", -1) // see `SetPrefix`.
+	c := &Client{w: writeCloser, prefix: prefix, clock: realClock{}, delimiters: defaultDelimiters, done: make(chan struct{})}
 	c.SetMaxPackageSize(defaultMaxPacketSize)
 
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if c.flushWatchdog > 0 {
+		go c.runFlushWatchdog(c.clock.NewTicker(c.flushWatchdog))
+	}
+
 	return c
 }
 
+// NewNoopClient returns a new `Client` which accepts all the calls and does nothing, the write methods return nil,
+// useful for tests and environments without a statsd server which would otherwise need nil-client guards.
+// `IsClosed` reports true after its `Close`, like any other client.
+func NewNoopClient() *Client {
+	c := NewClientWriter(ioutil.Discard, "")
+	c.noop = true
+	return c
+}
+
+// NewClientWriter same as `NewClient` but it accepts a plain `io.Writer`, i.e a `bytes.Buffer`.
+// The writer is never closed by the client.
+func NewClientWriter(w io.Writer, prefix string, opts ...Option) *Client {
+	if w == nil {
+		w = ioutil.Discard
+	}
+
+	return NewClient(nopCloser{w}, prefix, opts...)
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
 // SetMaxPackageSize sets the max buffer size,
 // when exceeds it flushes the metrics to the statsd server.
 //
@@ -148,10 +414,16 @@ func NewClient(writeCloser io.WriteCloser, prefix string) *Client {
 // Commodity Internet (512) - If you are routing over the internet a value in this range will be reasonable.
 // You might be able to go higher, but you are at the mercy of all the hops in your route.
 //
+// The kernel's send buffer of an UDP connection can be tuned through the `UDPWithBufferSize`.
+//
 // Read more at: https://github.com/etsy/statsd/blob/master/docs/metric_types.md#multi-metric-packets
 // Defaults to 1500.
 // See `FlushEvery` and `Flush` too.
 func (c *Client) SetMaxPackageSize(maxPacketSize int) {
+	if c == nil {
+		return
+	}
+
 	if maxPacketSize <= 0 {
 		return
 	}
@@ -160,14 +432,15 @@ func (c *Client) SetMaxPackageSize(maxPacketSize int) {
 	c.flush(-1)
 
 	c.maxPacketSize = maxPacketSize
-	c.buf = make([]byte, 0, maxPacketSize)
-	c.mu.Unlock()
+	c.buf = append(make([]byte, 0, maxPacketSize), c.buf...) // keep any metrics that could not be flushed yet.
+	c.unlock()
 }
 
 // SetFormatter accepts a function which accepts the full metric name and returns a formatted string.
-// Optionally, defaults to nil.
+// Optionally, defaults to nil. A nil "fmt" removes the current formatter, see `ClearFormatter`.
+// The buffered metrics are flushed before the change.
 func (c *Client) SetFormatter(fmt func(metricName string) string) {
-	if fmt == nil {
+	if c == nil {
 		return
 	}
 
@@ -175,28 +448,350 @@ func (c *Client) SetFormatter(fmt func(metricName string) string) {
 	c.flush(-1)
 
 	c.metricNameFormatter = fmt
-	c.mu.Unlock()
+	c.unlock()
+}
+
+// ClearFormatter removes the formatter set by the `SetFormatter`,
+// the metric names are written as they are after that.
+func (c *Client) ClearFormatter() {
+	c.SetFormatter(nil)
+}
+
+// SetPrefix changes the prefix of the metric names, it can be empty.
+// The new lines of the prefix are replaced with underscores, on `WithStrict` mode such a prefix is not set
+// and the `ErrNewline` is reported through the `OnError` instead.
+// The buffered metrics are flushed before the change.
+func (c *Client) SetPrefix(prefix string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	c.flush(-1)
+
+	if prefix, err := c.sanitizePrefix(prefix); err != nil {
+		c.errs = append(c.errs, err) // the prefix is not changed, see `OnError`.
+	} else {
+		c.prefix = c.dotPrefix(prefix)
+	}
+	c.unlock()
+}
+
+// sanitizePrefix replaces the new lines of a "prefix" with underscores, like the ones of the metric names,
+// or it returns `ErrNewline` on `WithStrict` mode.
+func (c *Client) sanitizePrefix(prefix string) (string, error) {
+	if strings.IndexByte(prefix, '\n') < 0 {
+		return prefix, nil
+	}
+
+	if c.strict {
+		return "", ErrNewline
+	}
+
+	return strings.Replace(prefix, "\n", "_", -1), nil
+}
+
+// dotPrefix appends the missing dot separator to a non-empty "prefix", see `WithAutoDot`.
+func (c *Client) dotPrefix(prefix string) string {
+	if !c.autoDot || prefix == "" || strings.HasSuffix(prefix, ".") {
+		return prefix
+	}
+
+	return prefix + "."
+}
+
+// Prefix returns the prefix of the metric names, see `SetPrefix`.
+func (c *Client) Prefix() string {
+	if c == nil {
+		return ""
+	}
+
+	c.mu.Lock()
+	prefix := c.prefix
+	c.unlock()
+
+	return prefix
+}
+
+// ClientConfig is a snapshot of the effective configuration of a client, see `Client#Config`.
+type ClientConfig struct {
+	Prefix        string
+	MaxPacketSize int
+	FlushInterval time.Duration // zero if the `FlushEvery` is not running.
+	TagStyle      TagStyle
+	HasFormatter  bool // reports whether a name formatter is set, see `SetFormatter`.
+}
+
+// Config returns the current configuration of the client, including the changes of the `Set*` calls,
+// i.e to log or assert how a client was wired up. A nil client returns the zero configuration.
+func (c *Client) Config() ClientConfig {
+	if c == nil {
+		return ClientConfig{}
+	}
+
+	c.mu.Lock()
+	cfg := ClientConfig{
+		Prefix:        c.prefix,
+		MaxPacketSize: c.maxPacketSize,
+		TagStyle:      c.tagStyle,
+		HasFormatter:  c.metricNameFormatter != nil,
+	}
+	if c.flushLoop != nil {
+		cfg.FlushInterval = c.flushLoop.interval
+	}
+	c.unlock()
+
+	return cfg
+}
+
+// flushLoop is the background goroutine of the `FlushEvery`.
+type flushLoop struct {
+	ticker   Ticker
+	interval time.Duration // see `Config`.
+	stop     chan struct{}
+	done     chan struct{} // closed when the goroutine exits.
+	once     sync.Once
+}
+
+func newFlushLoop(ticker Ticker, interval time.Duration) *flushLoop {
+	return &flushLoop{
+		ticker:   ticker,
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Stop stops the ticker and waits for the goroutine to exit.
+// It should not be called while holding the client's lock, the goroutine may be waiting for it.
+func (l *flushLoop) Stop() {
+	if l == nil {
+		return
+	}
+
+	l.once.Do(func() {
+		l.ticker.Stop()
+		close(l.stop)
+	})
+	<-l.done
+}
+
+func (c *Client) runFlushLoop(l *flushLoop) {
+	defer close(l.done)
+
+	for {
+		select {
+		case <-l.ticker.C():
+			c.tick()
+		case <-l.stop:
+			return
+		}
+	}
+}
+
+// tick is called by the `FlushEvery` goroutine on each tick,
+// it writes the registered gauges and flushes the buffered metrics.
+func (c *Client) tick() {
+	if c.beforeTick != nil {
+		c.beforeTick()
+	}
+
+	c.mu.Lock()
+	gauges := c.gauges
+	c.unlock()
+
+	// outside of the lock, the functions may use the client too.
+	for _, g := range gauges {
+		c.Gauge(g.name, g.fn())
+	}
+
+	if c.IsClosed() {
+		return
+	}
+
+	if c.swapFlush {
+		c.swapMu.Lock()
+	}
+
+	c.mu.Lock()
+	c.writeAggregates()
+
+	if c.selfPrefix != "" {
+		c.writeSelfMetrics()
+	}
+
+	var err error
+	if !c.deferFlush(c.clock.Now()) {
+		if c.swapFlush {
+			err = c.flushSwapped()
+		} else {
+			err = c.flush(-1)
+		}
+	}
+
+	if c.swapFlush {
+		c.swapMu.Unlock()
+	}
+	c.unlock()
+
+	c.reportError(err)
+}
+
+// writeSelfMetrics writes the client's own health gauges, see `WithSelfMetrics`.
+// They are appended with the self metrics prefix directly, without the formatter,
+// so they never go through the paths which generate metrics themselves.
+func (c *Client) writeSelfMetrics() {
+	metrics := [...]struct {
+		name  string
+		value uint64
+	}{
+		{"buffered_bytes", uint64(len(c.buf))},
+		{"flushes", c.FlushCount()},
+		{"packets", c.PacketsSent()},
+		{"dropped", c.Dropped()},
+	}
+
+	for _, m := range metrics {
+		n := len(c.buf)
+		c.buf = appendMetric(c.buf, c.selfPrefix, m.name, Uint64(m.value), Gauge, 1, c.tagStyle, c.delimiters, c.tags, 0)
+		c.flushFull(n)
+	}
+}
+
+// deferFlush reports whether the flush of a tick should be skipped
+// because the buffer is less filled than the `WithMinFill` ratio and the max deferral is not reached yet.
+func (c *Client) deferFlush(now time.Time) bool {
+	if c.minFill <= 0 || len(c.buf) == 0 || float64(len(c.buf)) >= c.minFill*float64(c.maxPacketSize) {
+		c.deferredSince = time.Time{}
+		return false
+	}
+
+	if c.deferredSince.IsZero() {
+		c.deferredSince = now
+	}
+
+	if now.Sub(c.deferredSince) >= c.maxDefer {
+		c.deferredSince = time.Time{}
+		return false
+	}
+
+	return true
+}
+
+type registeredGauge struct {
+	name string
+	fn   func() int
+}
+
+// RegisterGauge registers a gauge metric whose value is retrieved by "fn"
+// and written on each tick of the `FlushEvery`, useful for resource gauges like the current connections.
+// Registering an existing "metricName" replaces its function, a nil "fn" unregisters it.
+func (c *Client) RegisterGauge(metricName string, fn func() int) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	gauges := make([]registeredGauge, 0, len(c.gauges)+1)
+	for _, g := range c.gauges {
+		if g.name != metricName {
+			gauges = append(gauges, g)
+		}
+	}
+
+	if fn != nil {
+		gauges = append(gauges, registeredGauge{name: metricName, fn: fn})
+	}
+
+	c.gauges = gauges
+	c.unlock()
 }
 
 // FlushEvery accepts a duration which is used to create a new ticker
 // which will flush the buffered metrics on each tick.
-func (c *Client) FlushEvery(dur time.Duration) {
-	if dur == 0 || c.IsClosed() {
-		return
+// Calling it again terminates the previous ticker and its goroutine.
+// It returns `ErrClosed` if the client is already closed.
+// See `FlushEveryStop` to stop the periodic flushing without closing the client.
+func (c *Client) FlushEvery(dur time.Duration) error {
+	_, err := c.FlushEveryStop(dur)
+	return err
+}
+
+// FlushEveryStop same as `FlushEvery` but it returns a function which stops the ticker
+// and waits for its goroutine to exit, the buffered metrics are not flushed, i.e to switch back to manual flushing.
+// The function is a no-op if the ticker is already replaced by another `FlushEvery` call or the client is closed.
+func (c *Client) FlushEveryStop(dur time.Duration) (stop func(), err error) {
+	stop = func() {}
+
+	if c.disabled() {
+		return stop, nil
+	}
+
+	if c.IsClosed() {
+		return stop, ErrClosed
+	}
+
+	if dur == 0 {
+		return stop, nil
 	}
 
 	c.mu.Lock()
-	if c.flushTicker != nil {
-		c.flushTicker.Stop()
+	if c.IsClosed() { // closed while waiting for the lock.
+		c.unlock()
+		return stop, ErrClosed
 	}
-	c.flushTicker = time.NewTicker(dur)
-	c.mu.Unlock()
 
-	go func() {
-		for range c.flushTicker.C {
-			c.Flush(-1)
+	prev := c.flushLoop
+	loop := newFlushLoop(c.clock.NewTicker(dur), dur)
+	c.flushLoop = loop
+	c.unlock()
+
+	prev.Stop()
+	go c.runFlushLoop(loop)
+
+	stop = func() {
+		c.mu.Lock()
+		if c.flushLoop != loop {
+			c.unlock()
+			return // replaced or closed, already stopped.
 		}
-	}()
+		c.flushLoop = nil
+		c.unlock()
+
+		loop.Stop()
+	}
+
+	return stop, nil
+}
+
+// RemoteAddr returns the address of the statsd server,
+// if the client's writer is a network connection (i.e `UDP`), otherwise nil.
+// Useful to debug misconfigured endpoints.
+func (c *Client) RemoteAddr() net.Addr {
+	if c == nil {
+		return nil
+	}
+
+	if conn, ok := c.w.(interface{ RemoteAddr() net.Addr }); ok {
+		return conn.RemoteAddr()
+	}
+
+	return nil
+}
+
+// disabled reports whether the client's methods should do nothing,
+// i.e a nil client or a client created by the `NewNoopClient`.
+func (c *Client) disabled() bool {
+	return c == nil || c.noop
+}
+
+// now returns the current time of the client's clock, see `WithClock`.
+func (c *Client) now() time.Time {
+	if c == nil {
+		return time.Now()
+	}
+
+	return c.clock.Now()
 }
 
 // IsClosed reports whether the client is closed or not.
@@ -209,40 +804,73 @@ func (c *Client) IsClosed() bool {
 }
 
 // Close terminates the client,  before closing it will try to write any pending metrics.
+// It is safe to call it more than once, only the first call closes the writer.
 func (c *Client) Close() error {
-	if c != nil && c.w != nil {
-		atomic.StoreUint32(&c.closed, 1)
-
-		c.mu.Lock()
-		if c.flushTicker != nil {
-			c.flushTicker.Stop()
-		}
-		c.flush(-1)
-		c.mu.Unlock()
+	if c == nil || c.w == nil {
+		return nil
+	}
 
-		return c.w.Close()
+	if !atomic.CompareAndSwapUint32(&c.closed, 0, 1) {
+		return nil // already closed.
 	}
+	close(c.done)
 
-	return nil
+	c.swapMu.Lock() // wait for a swapped flush in progress, see `WithSwapFlush`.
+	c.mu.Lock()
+	loop := c.flushLoop
+	c.flushLoop = nil
+	c.limiter = nil // the last flush should not be deferred.
+	c.writeAggregates()
+	c.flush(-1)
+	c.swapMu.Unlock()
+	c.unlock()
+
+	loop.Stop()
+
+	return c.w.Close()
+}
+
+// delimiters are the separators of a metric line's fields, see `WithDelimiters`.
+type delimiters struct {
+	nameValue byte // between the name and the value.
+	valueType byte // before the type and the rest of the fields.
+	rate      byte // the sample rate's marker.
 }
 
-var rateSep = []byte("|@")
+var defaultDelimiters = delimiters{nameValue: ':', valueType: '|', rate: '@'}
+
+// AppendMetric appends a single metric line, terminated by a new line, to "dst" and returns the extended buffer.
+// It is the encoder which the `Client` uses to serialize its metrics, i.e "prefix.my_metric:1|c|@0.5\n".
+//
+// Note that it is the raw encoder, the "prefix" and the "metricName" are written as they are:
+// no formatter (see `SetFormatter`) and no negative gauges zero-reset are applied.
+func AppendMetric(dst []byte, prefix, metricName, value, typ string, rate float32) []byte {
+	return appendMetric(dst, prefix, metricName, value, typ, rate, TagStyleDatadog, defaultDelimiters, nil, 0)
+}
 
-func appendMetric(dst []byte, prefix, metricName, value, typ string, rate float32) []byte {
+func appendMetric(dst []byte, prefix, metricName, value, typ string, rate float32, style TagStyle, d delimiters, tags []string, timestamp int64) []byte {
 	dst = append(dst, prefix...)
 	dst = append(dst, metricName...)
-	dst = append(dst, ':')
+	dst = appendNameTags(dst, style, tags)
+	dst = append(dst, d.nameValue)
 
 	dst = append(dst, value...)
-	dst = append(dst, '|')
+	dst = append(dst, d.valueType)
 	dst = append(dst, typ...)
 
 	if rate != 1 {
-		dst = append(dst, rateSep...)
+		dst = append(dst, d.valueType, d.rate)
 		rateValue := strconv.FormatFloat(float64(rate), 'f', -1, 32)
 		dst = append(dst, rateValue...)
 	}
 
+	dst = appendSuffixTags(dst, style, d.valueType, tags)
+
+	if timestamp > 0 {
+		dst = append(dst, d.valueType, 'T')
+		dst = strconv.AppendInt(dst, timestamp, 10)
+	}
+
 	dst = append(dst, '\n')
 	return dst
 }
@@ -260,85 +888,1227 @@ func appendMetric(dst []byte, prefix, metricName, value, typ string, rate float3
 // The "typ" input argument is the type of the statsd,
 // i.e "c"(statsd.Count),"ms"(statsd.Time),"g"(statsd.Gauge) and "s"(`statsd.Unique`)
 //
-// The "rate" input argument is optional and defaults to 1.
+// The "rate" input argument is optional and defaults to 1, a zero rate is written as 1 even on `WithStrict` mode.
+// A negative rate or a rate greater than 1 is written as 1, unless `WithStrict` is used which returns `ErrInvalidRate` instead.
+//
+// It returns `ErrClosed` if the client is already closed.
+//
 // Use the `Client#Count`, `Client#Increment`, `Client#Gauge`, `Client#Unique`, `Client#Time`,
 // `Client#Record` and `Client#Histogram` for common metrics instead.
 func (c *Client) WriteMetric(metricName, value, typ string, rate float32) error {
+	if c.disabled() {
+		return nil
+	}
+
+	if c.IsClosed() {
+		return ErrClosed
+	}
+
 	c.mu.Lock()
-	err := c.writeMetric(metricName, value, typ, rate)
-	c.mu.Unlock()
+	err := c.writeMetric(metricName, value, typ, rate, nil, 0)
+	c.unlock()
 
 	return err
 }
 
-func (c *Client) writeMetric(metricName, value, typ string, rate float32) error {
-	n := len(c.buf)
+// WriteMetricFlushed same as `WriteMetric` but it reports whether this call sent the buffered metrics,
+// i.e because the metric would exceed the max packet size (see `SetMaxPackageSize`) or the `WithFlushEveryN`.
+// Useful to understand the batching behavior and to tune the max packet size.
+func (c *Client) WriteMetricFlushed(metricName, value, typ string, rate float32) (flushed bool, err error) {
+	if c.disabled() {
+		return false, nil
+	}
 
-	if c.metricNameFormatter != nil {
-		metricName = c.metricNameFormatter(metricName)
+	if c.IsClosed() {
+		return false, ErrClosed
 	}
 
-	if metricName == "" { // ignore if metric name is empty (after end-dev defined formatter executed).
+	c.mu.Lock()
+	sent := c.PacketsSent()
+	err = c.writeMetric(metricName, value, typ, rate, nil, 0)
+	flushed = c.PacketsSent() > sent
+	c.unlock()
+
+	return
+}
+
+// WriteMetricRawName same as `WriteMetric` but the formatter (see `SetFormatter`) is not applied to the "metricName",
+// i.e to mix names which are already formatted by another system with the auto-formatted ones.
+// The prefix and the rest of the client's options are still applied, except the `WithTimerAggregation`:
+// the `Time` metrics are written as they are, the aggregates are written with the client's formatter.
+func (c *Client) WriteMetricRawName(metricName, value, typ string, rate float32) error {
+	if c.disabled() {
+		return nil
+	}
+
+	if c.IsClosed() {
+		return ErrClosed
+	}
+
+	c.mu.Lock()
+	format, timers := c.metricNameFormatter, c.timers
+	c.metricNameFormatter, c.timers = nil, nil // for this write only, under the lock.
+	err := c.writeMetric(metricName, value, typ, rate, nil, 0)
+	c.metricNameFormatter, c.timers = format, timers
+	c.unlock()
+
+	return err
+}
+
+// WriteMetricPrefix same as `WriteMetric` but the metric is written with the given "prefix" instead of the client's one,
+// i.e a one-off metric of a shared subsystem, without creating a client for it. The client's prefix is not changed.
+// The `Time` metrics are not aggregated by the `WithTimerAggregation`, the aggregates are written with the client's prefix.
+// The new lines of the "prefix" are handled like the ones of the metric names, see `ErrNewline`.
+func (c *Client) WriteMetricPrefix(prefix, metricName, value, typ string, rate float32) error {
+	if c.disabled() {
+		return nil
+	}
+
+	if c.IsClosed() {
+		return ErrClosed
+	}
+
+	prefix, err := c.sanitizePrefix(prefix)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defaultPrefix, timers := c.prefix, c.timers
+	c.prefix, c.timers = c.dotPrefix(prefix), nil // for this write only, under the lock.
+	err = c.writeMetric(metricName, value, typ, rate, nil, 0)
+	c.prefix, c.timers = defaultPrefix, timers
+	c.unlock()
+
+	return err
+}
+
+// WriteMetricTyped same as `WriteMetric` but the metric type is checked at compile time
+// and against the known metric types, it returns `ErrInvalidType` for an unknown one.
+// Use the `WriteMetric` for custom metric types of specific servers.
+func (c *Client) WriteMetricTyped(metricName, value string, typ MetricType, rate float32) error {
+	if !typ.IsValid() {
+		return ErrInvalidType
+	}
+
+	return c.WriteMetric(metricName, value, string(typ), rate)
+}
+
+// WriteMetricAt same as `WriteMetric` but it writes the metric with the timestamp of "t", in unix seconds,
+// i.e "my_metric:1|c|T1555372800", useful to backfill historical data.
+//
+// Note that timestamps are not part of the standard statsd protocol,
+// they are supported by the DogStatsD servers (protocol v1.3, Datadog Agent v7.40+),
+// other servers may reject the metric.
+// Read more at: https://docs.datadoghq.com/developers/dogstatsd/datagram_shell/
+func (c *Client) WriteMetricAt(metricName, value, typ string, rate float32, t time.Time) error {
+	if c.disabled() {
+		return nil
+	}
+
+	if c.IsClosed() {
+		return ErrClosed
+	}
+
+	c.mu.Lock()
+	err := c.writeMetric(metricName, value, typ, rate, nil, t.Unix())
+	c.unlock()
+
+	return err
+}
+
+// WriteMetricMulti same as `WriteMetric` but it writes many "values" of the same metric in a single line,
+// i.e "my_metric:1:2:3|ms", it is more compact than one line per value.
+//
+// Note that the multi-value form is not part of the standard statsd protocol,
+// it is supported by the DogStatsD servers (protocol v1.1) for the timing and histogram metric types.
+// Read more at: https://docs.datadoghq.com/developers/dogstatsd/datagram_shell/
+func (c *Client) WriteMetricMulti(metricName string, values []string, typ string, rate float32) error {
+	if len(values) == 0 {
+		return nil
+	}
+
+	return c.WriteMetric(metricName, strings.Join(values, ":"), typ, rate)
+}
+
+func (c *Client) writeMetric(metricName, value, typ string, rate float32, tags []string, timestamp int64) error {
+	return c.writeMetricWith(c.negativeGauges, metricName, value, typ, rate, tags, timestamp)
+}
+
+// writeMetricWith same as `writeMetric` but the negative gauges are written based on the "negativeGauges" strategy,
+// i.e the gauge deltas are always written raw.
+func (c *Client) writeMetricWith(negativeGauges NegativeGaugeStrategy, metricName, value, typ string, rate float32, tags []string, timestamp int64) error {
+	if c.timers != nil && typ == Time && timestamp == 0 {
+		// the strict rules are checked before the aggregation, the aggregates are written later.
+		rate, err := c.normalizeRate(rate)
+		if err != nil {
+			return err
+		}
+
+		if c.strict {
+			if strings.IndexByte(metricName, '\n') >= 0 || strings.IndexByte(value, '\n') >= 0 {
+				return ErrNewline
+			}
+
+			if _, err = c.sanitizeTags(tags); err != nil {
+				return err
+			}
+		}
+
+		c.aggregateTimer(metricName, value, rate, tags)
+		return nil
+	}
+
+	n := len(c.buf)
+
+	metricName, value, rate, reset, err := c.normalizeMetric(negativeGauges, metricName, value, typ, rate)
+	if err != nil || metricName == "" {
+		return err
+	}
+
+	if tags, err = c.sanitizeTags(c.withGlobalTags(tags)); err != nil {
+		return err
+	}
+
+	if c.sampler != nil && (typ == Count || typ == Time || typ == Histogram) {
+		var keep bool
+		if rate, keep = c.sampler.sample(c.random(), c.now(), metricName, rate); !keep {
+			return nil
+		}
+	}
+
+	if c.seen != nil {
+		c.detectDuplicate(metricName, typ)
+	}
+
+	if reset {
+		if err := c.appendLines(n, metricName, "0", typ, rate, tags, timestamp); err != nil {
+			return err
+		}
+		n = len(c.buf)
+	}
+
+	return c.appendLines(n, metricName, value, typ, rate, tags, timestamp)
+}
+
+// normalizeRate returns the rate 1 for a zero (optional) or an out of range "rate",
+// or `ErrInvalidRate` for the latter on `WithStrict` mode.
+func (c *Client) normalizeRate(rate float32) (float32, error) {
+	if rate == 0 {
+		return 1, nil // optional.
+	}
+
+	if rate < 0 || rate > 1 {
+		if c.strict {
+			return 0, ErrInvalidRate
+		}
+		return 1, nil
+	}
+
+	return rate, nil
+}
+
+// normalizeMetric applies the rate, formatter and name rules of the client to a metric which is about to be written.
+// An empty returned "metricName" means that the metric should be ignored.
+// The "reset" reports whether a negative gauge should be preceded by a zero-reset, see `NegativeGaugeReset`.
+func (c *Client) normalizeMetric(negativeGauges NegativeGaugeStrategy, metricName, value, typ string, rate float32) (string, string, float32, bool, error) {
+	rate, err := c.normalizeRate(rate)
+	if err != nil {
+		return "", "", 0, false, err
+	}
+
+	if c.metricNameFormatter != nil {
+		metricName = c.metricNameFormatter(metricName)
+	}
+
+	// an embedded new line would split the metric line and corrupt the packet.
+	if strings.IndexByte(metricName, '\n') >= 0 || strings.IndexByte(value, '\n') >= 0 {
+		if c.strict {
+			return "", "", 0, false, ErrNewline
+		}
+
+		metricName = strings.Replace(metricName, "\n", "_", -1)
+		value = strings.Replace(value, "\n", "_", -1)
+	}
+
+	if c.autoDot && c.prefix != "" {
+		metricName = strings.TrimLeft(metricName, ".")
+	}
+
+	if c.maxNameLength > 0 {
+		// the same name is written under all the prefixes, it is limited by the longest one.
+		prefixLen := len(c.prefix)
+		for _, prefix := range c.additionalPrefixes {
+			if len(prefix) > prefixLen {
+				prefixLen = len(prefix)
+			}
+		}
+
+		if prefixLen+len(metricName) > c.maxNameLength {
+			if c.strict {
+				return "", "", 0, false, ErrNameTooLong
+			}
+
+			metricName = truncateName(metricName, c.maxNameLength-prefixLen) // empty if the prefix alone exceeds the limit.
+		}
+	}
+
+	if metricName == "" { // ignore if metric name is empty (after end-dev defined formatter executed).
+		return "", "", 0, false, nil
+	}
+
+	reset := false
+	if typ == Gauge && len(value) > 1 && value[0] == '-' {
+		switch negativeGauges {
+		case NegativeGaugeClamp:
+			value = "0"
+		case NegativeGaugeRaw:
+		default:
+			// we can't explicitly set a gauge to a negative number
+			// without first setting it to zero.
+			reset = true
+		}
+	}
+
+	return metricName, value, rate, reset, nil
+}
+
+// truncateName returns the first "n" bytes of "metricName", or less so a multi-byte character is not split.
+func truncateName(metricName string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+
+	for n > 0 && !utf8.RuneStart(metricName[n]) {
+		n--
+	}
+
+	return metricName[:n]
+}
+
+// Format returns the metric line(s) which the `WriteMetric` would write, without the last new line
+// and without writing them, i.e "my_prefix.my_metric:1|c|@0.5".
+// The prefix, the formatter, the global tags and the rest of the client's options are applied,
+// a negative gauge returns its zero-reset line too, i.e "my_gauge:0|g\nmy_gauge:-10|g".
+// It returns an empty string if the metric would be ignored or rejected, see `WithStrict`,
+// or if it would be aggregated instead of written, i.e a `Time` metric on `WithTimerAggregation`.
+// Note that the line carries the given "rate", the `WithAdaptiveSampling` may write it with a lower one or drop it.
+// Useful to assert on the wire format in tests.
+func (c *Client) Format(metricName, value, typ string, rate float32) string {
+	if c == nil {
+		return ""
+	}
+
+	c.mu.Lock()
+	defer c.unlock()
+
+	if c.timers != nil && typ == Time {
+		return ""
+	}
+
+	metricName, value, rate, reset, err := c.normalizeMetric(c.negativeGauges, metricName, value, typ, rate)
+	if err != nil || metricName == "" {
+		return ""
+	}
+
+	values := []string{value}
+	if reset {
+		values = []string{"0", value}
+	}
+
+	tags, err := c.sanitizeTags(c.withGlobalTags(nil))
+	if err != nil {
+		return ""
+	}
+
+	var dst []byte
+	for _, v := range values {
+		dst = appendMetric(dst, c.prefix, metricName, v, typ, rate, c.tagStyle, c.delimiters, tags, 0)
+		for _, prefix := range c.additionalPrefixes {
+			dst = appendMetric(dst, prefix, metricName, v, typ, rate, c.tagStyle, c.delimiters, tags, 0)
+		}
+	}
+
+	return string(dst[:len(dst)-1])
+}
+
+// appendLines appends a metric line under the client's prefix and each one of the `WithAdditionalPrefix`,
+// "n" is the buffer's length before the metric.
+func (c *Client) appendLines(n int, metricName, value, typ string, rate float32, tags []string, timestamp int64) error {
+	if c.group != nil {
+		return c.group.appendGroupLines(c, metricName, value, typ, rate, tags, timestamp)
+	}
+
+	c.buf = appendMetric(c.buf, c.prefix, metricName, value, typ, rate, c.tagStyle, c.delimiters, tags, timestamp)
+	if err := c.flushFull(n); err != nil {
+		return err
+	}
+
+	for _, prefix := range c.additionalPrefixes {
+		n = len(c.buf)
+		c.buf = appendMetric(c.buf, prefix, metricName, value, typ, rate, c.tagStyle, c.delimiters, tags, timestamp)
+		if err := c.flushFull(n); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// flushFull is called after a metric is appended to the buffer.
+// It flushes the first "n" bytes of the buffer, the metrics before the last one,
+// when the buffer's packet would exceed the `maxPacketSize` with the last metric.
+// That way a packet never exceeds the `maxPacketSize`, unless a single metric does.
+// It flushes the whole buffer when it holds N metrics too, see `WithFlushEveryN`.
+func (c *Client) flushFull(n int) error {
+	if c.flushWatchdog > 0 && n == 0 {
+		c.watchdogSince = c.clock.Now() // the buffer was empty.
+	}
+
+	if c.history != nil {
+		c.history.add(string(c.buf[n : len(c.buf)-1]))
+	}
+
+	if c.flushEveryN > 0 {
+		c.pending++
+	}
+
+	var err error
+	if len(c.buf) > c.packetLimit() {
+		err = c.flush(n)
+	}
+
+	if err == nil && c.flushEveryN > 0 && c.pending >= c.flushEveryN {
+		err = c.flush(-1)
+	}
+
+	c.dropOverflow() // the flush may fail or be deferred.
+	return err
+}
+
+// WriteRaw writes to the buffer a single, already formatted, metric line, i.e "my_metric:1|c".
+// The prefix and the formatter are not applied, the line is written as it is.
+// The caller is responsible for the correctness of the line, it should not contain a new line.
+//
+// When metrics are "big" enough (see `SetMaxPacketSize`) then they will be flushed to the statsd server.
+// It returns `ErrClosed` if the client is already closed.
+//
+// Useful to send custom metric types which are not covered by the rest of the `Client` methods.
+func (c *Client) WriteRaw(line string) error {
+	if c.disabled() {
 		return nil
 	}
 
-	if typ == Gauge && len(value) > 1 && value[0] == '-' {
-		// we can't explicitly set a gauge to a negative number
-		// without first setting it to zero.
-		err := c.writeMetric(metricName, "0", Gauge, rate)
-		if err != nil {
-			return err
-		}
+	if c.IsClosed() {
+		return ErrClosed
+	}
+
+	c.mu.Lock()
+	err := c.writeRaw(line)
+	c.unlock()
+
+	return err
+}
+
+func (c *Client) writeRaw(line string) error {
+	if line == "" {
+		return nil
+	}
+
+	n := len(c.buf)
+	c.buf = append(c.buf, line...)
+	c.buf = append(c.buf, '\n')
+	return c.flushFull(n)
+}
+
+// WriteBatch writes to the buffer the already formatted, new line delimited, metric lines of "payload",
+// i.e a payload received by a statsd relay, under a single lock. Empty lines are skipped, like the `CopyFrom`.
+// Like the `WriteRaw`, the prefix and the formatter are not applied and each line is packed by the max packet size,
+// a packet never splits a line.
+// All the lines are written, a flush error does not drop the rest of them, it returns the first error.
+// It returns `ErrClosed` if the client is already closed.
+func (c *Client) WriteBatch(payload []byte) error {
+	if c.disabled() {
+		return nil
+	}
+
+	if c.IsClosed() {
+		return ErrClosed
+	}
+
+	var err error
+
+	c.mu.Lock()
+	for len(payload) > 0 {
+		line := payload
+		if i := bytes.IndexByte(payload, '\n'); i >= 0 {
+			line, payload = payload[:i], payload[i+1:]
+		} else {
+			payload = nil
+		}
+
+		line = bytes.TrimSuffix(line, []byte{'\r'})
+		if werr := c.writeRaw(string(line)); werr != nil && err == nil {
+			err = werr
+		}
+	}
+	c.unlock()
+
+	return err
+}
+
+// CopyFrom reads new line delimited metric lines from "r" and writes each one of them through the `WriteRaw`,
+// i.e to replay a captured metric stream through the client. Empty lines are skipped.
+// It returns the number of the written lines and the first write or read error.
+func (c *Client) CopyFrom(r io.Reader) (int, error) {
+	var (
+		written int
+		scanner = bufio.NewScanner(r)
+	)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+
+		if err := c.WriteRaw(line); err != nil {
+			return written, err
+		}
+		written++
+	}
+
+	return written, scanner.Err()
+}
+
+// Flush can be called manually, when `FlushEvery` is not configured, to flush the buffered metrics to the statsd server.
+// Negative or zero "n" value will flush everything from the buffer,
+// it is written packet by packet so each write respects the max packet size.
+// Flush is synchronous: when it returns without an error the metrics are written to the client's writer.
+// On a write error the metrics are kept in the buffer and they are retried on the next flush,
+// see `WithMaxBufferBytes` to limit the buffer growth.
+// A temporary write error, i.e a full send buffer of a UDP socket, is not returned, see `Client#Deferred`.
+// It returns `ErrClosed` if the client is already closed.
+// See `SetMaxPacketSize` too.
+func (c *Client) Flush(n int) error {
+	if c.disabled() {
+		return nil
+	}
+
+	if c.IsClosed() {
+		return ErrClosed
+	}
+
+	_, err := c.flushCount(n)
+	return err
+}
+
+// FlushIfPending same as `Flush(-1)` but it reports whether any data were written to the client's writer,
+// i.e false when the buffer was empty or nothing could be sent.
+func (c *Client) FlushIfPending() (flushed bool, err error) {
+	if c.disabled() {
+		return false, nil
+	}
+
+	if c.IsClosed() {
+		return false, ErrClosed
+	}
+
+	packets, err := c.flushCount(-1)
+	return packets > 0, err
+}
+
+// flushCount is the `Flush`, a full flush writes the aggregates first and it is swapped on `WithSwapFlush`.
+// It returns the number of the packets sent.
+func (c *Client) flushCount(n int) (packets uint64, err error) {
+	swapped := c.swapFlush && n <= 0
+	if swapped {
+		c.swapMu.Lock()
+	}
+
+	c.mu.Lock()
+	if n <= 0 {
+		c.writeAggregates()
+	}
+
+	sent := c.PacketsSent()
+	if swapped {
+		err = c.flushSwapped()
+		c.swapMu.Unlock()
+	} else {
+		err = c.flush(n)
+	}
+	packets = c.PacketsSent() - sent
+	c.unlock()
+
+	return
+}
+
+func (c *Client) flush(n int) error {
+	c.beginFlush(n)
+
+	if len(c.buf) == 0 {
+		return nil
+	}
+
+	if n <= 0 {
+		n = len(c.buf)
+	}
+
+	if c.onFlushStats == nil {
+		return c.flushPackets(n)
+	}
+
+	stats := FlushStats{}
+	c.stats = &stats
+	start := c.clock.Now()
+	err := c.flushPackets(n)
+	stats.Duration = c.clock.Now().Sub(start)
+	stats.Err = err
+	c.stats = nil
+
+	if stats.Packets > 0 || err != nil {
+		c.flushStats = append(c.flushStats, stats)
+	}
+
+	return err
+}
+
+// beginFlush updates the flush window state of a flush of the first "n" bytes of the buffer, all of them if "n" <= 0.
+func (c *Client) beginFlush(n int) {
+	if c.flushWatchdog > 0 {
+		c.watchdogSince = c.clock.Now()
+	}
+
+	if c.seen != nil && n <= 0 {
+		c.seen = make(map[string]struct{}) // a new flush window.
+	}
+
+	if n <= 0 {
+		c.dynamicFresh = false // see `WithDynamicTags`.
+	}
+}
+
+// flushPackets sends the first "n" bytes of the buffer, packet by packet, see `flush`.
+// A writer which buffers the metrics itself is flushed once, after the last packet of a flush of the whole buffer,
+// the partial flushes of a full packet (see `flushFull`) are batched with it.
+func (c *Client) flushPackets(n int) error {
+	whole := n == len(c.buf)
+
+	if c.limiter == nil {
+		// send packet by packet, a buffer which grew beyond the max packet size,
+		// i.e after failed flushes, is never written as a single oversized datagram.
+		for n > 0 {
+			end := c.packetEnd(n)
+			if err := c.send(end); err != nil {
+				return c.deferTemporary(err)
+			}
+			n -= end
+		}
+
+		if whole {
+			if err := c.flushWriter(); err != nil {
+				return c.deferTemporary(err)
+			}
+		}
+
+		atomic.AddUint64(&c.flushes, 1)
+		return nil
+	}
+
+	// send packet by packet, as long as the rate limit allows it,
+	// the rest is kept in the buffer for the next flush.
+	sent := false
+	for n > 0 && c.limiter.allow(c.clock.Now()) {
+		end := c.packetEnd(n)
+		if err := c.send(end); err != nil {
+			return c.deferTemporary(err)
+		}
+		n -= end
+		sent = true
+	}
+
+	if sent {
+		if whole {
+			if err := c.flushWriter(); err != nil {
+				return c.deferTemporary(err)
+			}
+		}
+		atomic.AddUint64(&c.flushes, 1)
+	}
+
+	c.dropOverflow()
+	return nil
+}
+
+// flushWriter flushes a writer which buffers the flushed metrics itself, see `flusher`.
+func (c *Client) flushWriter() error {
+	if f, ok := c.w.(flusher); ok {
+		return f.Flush()
+	}
+
+	return nil
+}
+
+// deferTemporary returns nil for a temporary write error, i.e a full send buffer of a UDP socket under a burst,
+// and it counts the deferred flush (see `Client#Deferred`), the unwritten metrics are kept for the next flush.
+// Any other error is returned as it is.
+func (c *Client) deferTemporary(err error) error {
+	if !isTemporary(err) {
+		return err
+	}
+
+	atomic.AddUint64(&c.deferred, 1)
+	return nil
+}
+
+// isTemporary reports whether "err" is a transient write error, i.e "ENOBUFS" or "EAGAIN" of a socket.
+// The timeouts, see `WithWriteTimeout`, are not temporary, the connection may be stuck.
+func isTemporary(err error) bool {
+	for {
+		if temporary, ok := temporaryErrno(err); ok {
+			return temporary // the errnos report the EAGAIN as a timeout too.
+		}
+
+		switch e := err.(type) {
+		case *net.OpError:
+			err = e.Err
+		case *os.SyscallError:
+			err = e.Err
+		case interface{ Timeout() bool }:
+			if e.Timeout() {
+				return false
+			}
+			t, ok := e.(interface{ Temporary() bool })
+			return ok && t.Temporary()
+		case interface{ Temporary() bool }:
+			return e.Temporary()
+		default:
+			return false
+		}
+	}
+}
+
+// FramingMode is the way the metrics are framed when written to the statsd server, see `WithFraming`.
+type FramingMode uint8
+
+const (
+	// FramingUDP writes each packet without the new line of its last metric,
+	// each write is a single UDP datagram. This is the default framing.
+	FramingUDP FramingMode = iota
+	// FramingStream writes each packet with all of its new lines,
+	// required by byte-stream transports, i.e TCP and Unix, where packets are concatenated.
+	FramingStream
+)
+
+// send writes the first "n" bytes of the buffer,
+// they are removed from the buffer only if the write succeeds.
+func (c *Client) send(n int) error {
+	payload, written, err := c.writePacket(c.buf[:n], &c.encoded)
+	if err != nil {
+		if written > 0 {
+			// the written head of a stream is not retried, only its tail.
+			c.buf = c.buf[:copy(c.buf, c.buf[written:])]
+			if c.flushEveryN > 0 {
+				c.pending = bytes.Count(c.buf, newLine)
+			}
+		}
+
+		return err
+	}
+
+	if c.stats != nil {
+		c.stats.Packets++
+		c.stats.Bytes += len(payload)
+		c.stats.Metrics += bytes.Count(c.buf[:n], newLine)
+	}
+
+	if c.onFlush != nil {
+		p := getBuffer()
+		*p = append(*p, payload...)
+		c.flushed = append(c.flushed, p)
+	}
+
+	if n < len(c.buf) {
+		copy(c.buf, c.buf[n:])
+	}
+
+	c.buf = c.buf[:len(c.buf)-n] // or written-1.
+	atomic.AddUint64(&c.packets, 1)
+
+	if c.flushEveryN > 0 {
+		c.pending = bytes.Count(c.buf, newLine) // the metrics left after a partial flush.
+	}
+
+	return nil
+}
+
+// writePacket writes the "packet" of metric lines, encoded and framed based on the client's options,
+// "encoded" is the reused buffer of the `WithEncoding`. It returns the written payload and the number of the written
+// bytes of the "packet", it is not zero on failure only when the written head of a stream should not be retried.
+func (c *Client) writePacket(packet []byte, encoded *[]byte) (payload []byte, written int, err error) {
+	payload = packet
+	if c.encoding == EncodingMsgpack {
+		*encoded = appendMsgpackPacket((*encoded)[:0], packet, c.delimiters)
+		payload = *encoded
+	} else if c.framing == FramingUDP {
+		payload = payload[:len(packet)-1] // without the last "\n".
+	}
+
+	if c.writeTimeout > 0 {
+		if conn, ok := c.w.(interface{ SetWriteDeadline(time.Time) error }); ok {
+			conn.SetWriteDeadline(time.Now().Add(c.writeTimeout)) // the deadline is in wall clock time.
+		}
+	}
+
+	if written, err = c.write(payload); err != nil {
+		if c.framing != FramingStream || c.encoding != EncodingText {
+			written = 0
+		}
+
+		return payload, written, err
+	}
+
+	return payload, len(packet), nil
+}
+
+// write writes the whole "payload" and returns the number of the written bytes.
+// On `FramingStream` it retries the short writes of the writers which return less bytes than requested without an error,
+// a short write of a datagram fails with `io.ErrShortWrite` instead, its tail would be a broken packet.
+func (c *Client) write(payload []byte) (int, error) {
+	written := 0
+	for written < len(payload) {
+		n, err := c.w.Write(payload[written:])
+		written += n
+		if err != nil {
+			return written, err
+		}
+
+		if written < len(payload) && (n == 0 || c.framing != FramingStream) {
+			return written, io.ErrShortWrite
+		}
+	}
+
+	return written, nil
+}
+
+// packetLimit returns the max number of buffered bytes of a packet.
+func (c *Client) packetLimit() int {
+	if c.framing == FramingUDP {
+		return c.maxPacketSize + 1 // the last "\n" is not written.
+	}
+
+	return c.maxPacketSize
+}
+
+// packetEnd returns the length of the first packet of the first "n" bytes of the buffer,
+// a packet ends on a new line and its length does not exceed the `maxPacketSize` (unless a single metric does).
+func (c *Client) packetEnd(n int) int {
+	return packetEndOf(c.buf, n, c.packetLimit())
+}
+
+// packetEndOf same as `Client#packetEnd` but for the metric lines of "buf" and the packet "limit".
+func packetEndOf(buf []byte, n, limit int) int {
+	if n <= limit {
+		return n
+	}
+
+	if i := bytes.LastIndexByte(buf[:limit], '\n'); i >= 0 {
+		return i + 1
 	}
 
-	c.buf = appendMetric(c.buf, c.prefix, metricName, value, typ, rate)
+	if i := bytes.IndexByte(buf[:n], '\n'); i >= 0 {
+		return i + 1
+	}
 
-	if len(c.buf) > c.maxPacketSize {
-		err := c.flush(n)
-		if err != nil {
-			return err
+	return n
+}
+
+// rateLimitBufferPackets is the number of packets that can be kept
+// in the buffer while flushes are deferred by the `WithRateLimit`.
+const rateLimitBufferPackets = 16
+
+func (c *Client) bufferLimit() int {
+	if c.maxBufferSize > 0 {
+		if c.maxBufferSize < c.maxPacketSize {
+			return c.maxPacketSize
 		}
+
+		return c.maxBufferSize
 	}
 
-	return nil
+	if c.limiter != nil {
+		return rateLimitBufferPackets * c.maxPacketSize
+	}
+
+	return 0
 }
 
-// Flush can be called manually, when `FlushEvery` is not configured, to flush the buffered metrics to the statsd server.
-// Negative or zero "n" value will flush everything from the buffer.
-// See `SetMaxPacketSize` too.
-func (c *Client) Flush(n int) error {
+// dropOverflow drops the oldest metrics of the buffer when it exceeds the `bufferLimit`.
+func (c *Client) dropOverflow() {
+	limit := c.bufferLimit()
+	if limit <= 0 || len(c.buf) <= limit {
+		return
+	}
+
+	// drop whole metrics only.
+	cut := len(c.buf) - limit
+	if i := bytes.IndexByte(c.buf[cut-1:], '\n'); i >= 0 {
+		cut += i
+	} else {
+		cut = len(c.buf)
+	}
+
+	atomic.AddUint64(&c.dropped, uint64(bytes.Count(c.buf[:cut], newLine)))
+	c.buf = c.buf[:copy(c.buf, c.buf[cut:])]
+}
+
+var newLine = []byte("\n")
+
+// OnFlush registers a function which is called with the exact bytes of each packet written to the statsd server,
+// useful for debugging, audit logging or tests.
+// The "payload" is not a copy owned by the function: it is a pooled buffer which is re-used for the next packets
+// after the function returns, so the flushes don't allocate, copy it in order to retain it,
+// i.e `append([]byte(nil), payload...)`, or the retained payloads are overwritten.
+// It is called outside of the client's lock, after the flush.
+func (c *Client) OnFlush(fn func(payload []byte)) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	c.onFlush = fn
+	c.unlock()
+}
+
+// OnError registers a function which is called with the errors which can not be returned to the caller,
+// i.e the flush errors of the `FlushEvery` ticks and the `WithFlushWatchdog` and `WithDuplicateDetection` warnings.
+// It is called outside of the client's lock.
+func (c *Client) OnError(fn func(err error)) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	c.onError = fn
+	c.unlock()
+}
+
+// reportError passes a non-nil "err" to the `OnError`, if any.
+// It should not be called while holding the client's lock.
+func (c *Client) reportError(err error) bool {
+	if err == nil {
+		return false
+	}
+
 	c.mu.Lock()
-	err := c.flush(n)
+	fn := c.onError
+	c.unlock()
+
+	if fn == nil {
+		return false
+	}
+
+	fn(err)
+	return true
+}
+
+// runFlushWatchdog reports an `ErrNotFlushed` on each "ticker" tick
+// while the buffered metrics are not flushed for the `WithFlushWatchdog` duration, until the client is closed.
+func (c *Client) runFlushWatchdog(ticker Ticker) {
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			c.mu.Lock()
+			now := c.clock.Now()
+			stale := len(c.buf) > 0 && now.Sub(c.watchdogSince) >= c.flushWatchdog
+			if stale {
+				c.watchdogSince = now // report again after another period.
+			}
+			c.unlock()
+
+			if stale && !c.reportError(ErrNotFlushed) {
+				log.Printf("%v", ErrNotFlushed)
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// unlock unlocks the client and reports the flushed packets, if any, to the `OnFlush`.
+func (c *Client) unlock() {
+	fn, flushed := c.onFlush, c.flushed
+	statsFn, stats := c.onFlushStats, c.flushStats
+	errFn, errs := c.onError, c.errs
+	if len(flushed) > 0 {
+		c.flushed = nil // owned by this call until the packets are reported.
+	}
+	c.flushStats, c.errs = nil, nil
 	c.mu.Unlock()
 
-	return err
+	for _, err := range errs {
+		if errFn != nil {
+			errFn(err)
+		} else {
+			log.Printf("%v", err)
+		}
+	}
+
+	for i, p := range flushed {
+		fn(*p)
+		putBuffer(p)
+		flushed[i] = nil
+	}
+
+	if len(flushed) > 0 {
+		// the slice is kept for the next flush, unless another flush took its place meanwhile.
+		c.mu.Lock()
+		if c.flushed == nil {
+			c.flushed = flushed[:0]
+		}
+		c.mu.Unlock()
+	}
+
+	for _, s := range stats {
+		statsFn(s)
+	}
 }
 
-func (c *Client) flush(n int) error {
-	if len(c.buf) == 0 {
+// DuplicateMetricError is reported through the `Client#OnError` by the `WithDuplicateDetection`
+// when a metric is written more than once in the same flush window.
+type DuplicateMetricError struct {
+	Name string
+	Type string
+}
+
+func (e *DuplicateMetricError) Error() string {
+	return "statsd: duplicate metric " + e.Name + " of type " + e.Type + " in the same flush window"
+}
+
+// detectDuplicate reports a `DuplicateMetricError` if the "metricName" of a tracked "typ"
+// is already written in the current flush window, see `WithDuplicateDetection`.
+func (c *Client) detectDuplicate(metricName, typ string) {
+	tracked := false
+	for _, t := range c.duplicateTypes {
+		if t == typ {
+			tracked = true
+			break
+		}
+	}
+
+	if !tracked {
+		return
+	}
+
+	key := typ + "|" + metricName
+	if _, ok := c.seen[key]; ok {
+		c.errs = append(c.errs, &DuplicateMetricError{Name: metricName, Type: typ})
+		return
+	}
+
+	c.seen[key] = struct{}{}
+}
+
+// FlushStats describes a flush of the buffered metrics, see `OnFlushStats`.
+type FlushStats struct {
+	// Metrics is the number of the sent metric lines.
+	Metrics int
+	// Packets is the number of the sent packets, i.e the writes.
+	Packets int
+	// Bytes is the number of the sent bytes.
+	Bytes int
+	// Duration is the time spent on the writes, based on the `WithClock`.
+	Duration time.Duration
+	// Err is the write error, if any. The failed packet and the rest are kept in the buffer.
+	Err error
+}
+
+// OnFlushStats registers a function which is called with the statistics of each flush,
+// useful to monitor the client's send path in production, i.e a slow statsd server.
+// It is called outside of the client's lock, after the flush.
+func (c *Client) OnFlushStats(fn func(stats FlushStats)) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	c.onFlushStats = fn
+	c.unlock()
+}
+
+// bufferPool keeps the transient copies of the flushed packets, see `OnFlush`.
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, defaultMaxPacketSize)
+		return &b
+	},
+}
+
+func getBuffer() *[]byte {
+	p := bufferPool.Get().(*[]byte)
+	*p = (*p)[:0]
+	return p
+}
+
+func putBuffer(p *[]byte) {
+	bufferPool.Put(p)
+}
+
+// FlushCount returns the total number of successful flushes.
+func (c *Client) FlushCount() uint64 {
+	if c == nil {
+		return 0
+	}
+
+	return atomic.LoadUint64(&c.flushes)
+}
+
+// PacketsSent returns the total number of packets successfully written to the statsd server.
+// A single flush may send more than one packet, see `WithRateLimit`.
+func (c *Client) PacketsSent() uint64 {
+	if c == nil {
+		return 0
+	}
+
+	return atomic.LoadUint64(&c.packets)
+}
+
+// Deferred returns the total number of flushes which were interrupted by a temporary write error,
+// i.e a full send buffer of a UDP socket, their unwritten metrics were kept in the buffer for the next flush.
+func (c *Client) Deferred() uint64 {
+	if c == nil {
+		return 0
+	}
+
+	return atomic.LoadUint64(&c.deferred)
+}
+
+// Dropped returns the total number of metrics which dropped
+// because the buffer reached its limit, see `WithMaxBufferBytes` and `WithRateLimit`.
+func (c *Client) Dropped() uint64 {
+	if c == nil {
+		return 0
+	}
+
+	return atomic.LoadUint64(&c.dropped)
+}
+
+// defaultRate returns the sample rate of the shortcut methods for the "typ" metric type.
+func (c *Client) defaultRate(typ string) float32 {
+	if c == nil {
+		return 1
+	}
+
+	if rate, ok := c.rates[typ]; ok {
+		return rate
+	}
+
+	return 1
+}
+
+// sampleDefault returns the default rate of the "typ" metric type and reports whether the write of a shortcut method
+// should be kept, a rate below 1 keeps 1 out of 1/rate writes, picked by the client's random source (see `WithRandSource`).
+// It should be called under the lock.
+func (c *Client) sampleDefault(typ string) (float32, bool) {
+	rate := c.defaultRate(typ)
+	if rate <= 0 || rate >= 1 {
+		return rate, true
+	}
+
+	return rate, c.random().Float32() < rate
+}
+
+// writeDefault writes a metric of a shortcut method, sampled at the default rate of its type, see `sampleDefault`.
+func (c *Client) writeDefault(metricName, value, typ string, tags []string) error {
+	if c.disabled() {
 		return nil
 	}
 
-	if n <= 0 {
-		n = len(c.buf)
+	if c.IsClosed() {
+		return ErrClosed
 	}
 
-	_, err := c.w.Write(c.buf[:n-1] /* without last "\n" for udp but on tcp may be required, waiting for feedback */)
-	if err != nil {
-		return err
+	var err error
+	c.mu.Lock()
+	if rate, ok := c.sampleDefault(typ); ok {
+		err = c.writeMetric(metricName, value, typ, rate, tags, 0)
 	}
+	c.unlock()
 
-	if n < len(c.buf) {
-		copy(c.buf, c.buf[n:])
+	return err
+}
+
+// NegativeGaugeStrategy is the way the negative gauge values are written, see `WithNegativeGaugeStrategy`.
+type NegativeGaugeStrategy uint8
+
+const (
+	// NegativeGaugeReset writes a zero value before the negative value, i.e "my_gauge:0|g\nmy_gauge:-10|g",
+	// because the etsy statsd server can't explicitly set a gauge to a negative number
+	// (a signed value changes the current gauge value instead). This is the default strategy.
+	NegativeGaugeReset NegativeGaugeStrategy = iota
+	// NegativeGaugeClamp writes zero instead of the negative value, i.e "my_gauge:0|g".
+	NegativeGaugeClamp
+	// NegativeGaugeRaw writes the negative value as it is, i.e "my_gauge:-10|g",
+	// for servers which accept negative gauge values, i.e netdata.
+	NegativeGaugeRaw
+)
+
+// ShouldSample reports whether an event sampled at "rate" should be written, using the client's random source
+// (see `WithRandSource`), the same one of the client's own sampling, i.e `WithAdaptiveSampling`.
+// Useful to skip the computation of an expensive metric, i.e its tags, when it would be dropped anyway.
+//
+// Usage:
+// if client.ShouldSample(0.1) { client.WriteMetricTags("my_metric", "1", statsd.Count, 0.1, expensiveTags()...) }
+//
+// A rate out of the (0, 1) range is always sampled. It reports false for a nil or noop client, nothing would be written.
+func (c *Client) ShouldSample(rate float32) bool {
+	if c.disabled() {
+		return false
 	}
 
-	c.buf = c.buf[:len(c.buf)-n] // or written-1.
-	return nil
+	if rate <= 0 || rate >= 1 {
+		return true
+	}
+
+	c.mu.Lock()
+	keep := c.random().Float32() < rate
+	c.mu.Unlock()
+
+	return keep
+}
+
+// random returns the client's random source, it should be called under the lock.
+func (c *Client) random() *rand.Rand {
+	if c.rng == nil {
+		c.rng = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+
+	return c.rng
 }
 
-// Count is a shortcut of `Client#WriteMetric(metricName, statsd.Int(value), statsd.Count, 1)`.
+// Count is a shortcut of `Client#WriteMetric(metricName, statsd.Int(value), statsd.Count, 1)`,
+// the rate can be customized through the `WithDefaultRate`.
+//
+// A negative value decrements the counter and it is written as it is, i.e "my_metric:-5|c",
+// the zero-reset of the negative gauges does not apply to counters.
 func (c *Client) Count(metricName string, value int) error {
-	return c.WriteMetric(metricName, Int(value), Count, 1)
+	return c.writeDefault(metricName, Int(value), Count, nil)
+}
+
+// CountSampled writes a Count metric of "value" which stands for "observed" events,
+// with the implied sample rate of value/observed, i.e 10 out of 40 observed events is written as "my_metric:10|c|@0.25"
+// and the server upscales it to 40.
+// The implied rate should be in the (0, 1] range, see `Client#WriteMetric`.
+func (c *Client) CountSampled(metricName string, value, observed int) error {
+	rate := float32(1)
+	if value != observed {
+		rate = float32(value) / float32(observed)
+	}
+
+	return c.WriteMetric(metricName, Int(value), Count, rate)
 }
 
 // Increment is a shortcut of `Client#Count(metricName, 1)`.
@@ -346,14 +2116,124 @@ func (c *Client) Increment(metricName string) error {
 	return c.Count(metricName, 1)
 }
 
-// Gauge is a shortcut of `Client#WriteMetric(metricName, statsd.Int(value), statsd.Gauge, 1)`.
+// Gauge is a shortcut of `Client#WriteMetric(metricName, statsd.Int(value), statsd.Gauge, 1)`,
+// the rate can be customized through the `WithDefaultRate`.
+//
+// A gauge supports three operations, each one with its own wire format:
+// - set, i.e "my_gauge:10|g", see `GaugeSet`, the same as `Gauge`.
+// - set to a negative value, i.e "my_gauge:0|g\nmy_gauge:-10|g", the zero-reset is required because
+// a signed value is a delta, see `NegativeGaugeStrategy` for the alternatives.
+// - delta, i.e "my_gauge:+2|g" or "my_gauge:-2|g", see `GaugeDelta`.
 func (c *Client) Gauge(metricName string, value int) error {
-	return c.WriteMetric(metricName, Int(value), Gauge, 1)
+	return c.writeDefault(metricName, Int(value), Gauge, nil)
+}
+
+// GaugeSet sets the Gauge metric to the absolute "value", the name states the operation explicitly
+// next to the `GaugeDelta`, it is the same as `Gauge`: a negative value is written based on the `NegativeGaugeStrategy`,
+// so the gauge is set to it instead of being decreased, i.e "my_gauge:0|g\nmy_gauge:-10|g" by default.
+func (c *Client) GaugeSet(metricName string, value int) error {
+	return c.Gauge(metricName, value)
+}
+
+// Gauges writes a Gauge metric for each one of the "values" under a single lock,
+// useful for periodic reporters which compute a snapshot of many gauges.
+// The gauges are written in the order of their names, so the packets are deterministic. It stops on the first error.
+func (c *Client) Gauges(values map[string]int) error {
+	if c.disabled() {
+		return nil
+	}
+
+	if c.IsClosed() {
+		return ErrClosed
+	}
+
+	names := make([]string, 0, len(values))
+	for metricName := range values {
+		names = append(names, metricName)
+	}
+	sort.Strings(names)
+
+	c.mu.Lock()
+	defer c.unlock()
+
+	for _, metricName := range names {
+		value := values[metricName]
+		rate, ok := c.sampleDefault(Gauge)
+		if !ok {
+			continue
+		}
+
+		if err := c.writeMetric(metricName, Int(value), Gauge, rate, nil, 0); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GaugeRate same as `Client#Gauge` but with a custom sample "rate".
+// The zero-reset of a negative value (see `NegativeGaugeReset`) is written with the same rate.
+func (c *Client) GaugeRate(metricName string, value int, rate float32) error {
+	return c.WriteMetric(metricName, Int(value), Gauge, rate)
 }
 
-// GaugeFloat64 is a shortcut of `Client#WriteMetric(metricName, statsd.Float64(value), statsd.Gauge, 1)`.
+// GaugeFloat64 is a shortcut of `Client#WriteMetric(metricName, statsd.Float64(value), statsd.Gauge, 1)`,
+// the rate can be customized through the `WithDefaultRate` and the format through the `WithFloatFormat`.
 func (c *Client) GaugeFloat64(metricName string, value float64) error {
-	return c.WriteMetric(metricName, Float64(value), Gauge, 1)
+	return c.writeDefault(metricName, c.formatFloat(value), Gauge, nil)
+}
+
+// GaugeDelta writes a relative change of a Gauge metric, i.e "my_gauge:+2|g" or "my_gauge:-2|g",
+// the server adds the "delta" to the gauge's current value.
+// A negative delta keeps its sign, it is never zero-reset (see `NegativeGaugeStrategy`).
+// The rate can be customized through the `WithDefaultRate`.
+func (c *Client) GaugeDelta(metricName string, delta int) error {
+	value := Int(delta)
+	if delta >= 0 {
+		value = "+" + value
+	}
+
+	return c.writeGaugeDelta(metricName, value)
+}
+
+// GaugeDeltaFloat same as `Client#GaugeDelta` but for fractional changes, i.e "my_gauge:-0.25|g",
+// the float format can be customized through the `WithFloatFormat`.
+func (c *Client) GaugeDeltaFloat(metricName string, delta float64) error {
+	value := c.formatFloat(delta)
+	if value[0] != '-' {
+		value = "+" + value
+	}
+
+	return c.writeGaugeDelta(metricName, value)
+}
+
+func (c *Client) writeGaugeDelta(metricName, value string) error {
+	if c.disabled() {
+		return nil
+	}
+
+	if c.IsClosed() {
+		return ErrClosed
+	}
+
+	var err error
+	c.mu.Lock()
+	if rate, ok := c.sampleDefault(Gauge); ok {
+		err = c.writeMetricWith(NegativeGaugeRaw, metricName, value, Gauge, rate, nil, 0)
+	}
+	c.unlock()
+
+	return err
+}
+
+// formatFloat returns the string form of "v" based on the `WithFloatFormat`,
+// it defaults to the `Float64` value helper.
+func (c *Client) formatFloat(v float64) string {
+	if c == nil || c.floatFormat == 0 {
+		return Float64(v)
+	}
+
+	return strconv.FormatFloat(v, c.floatFormat, c.floatPrecision, 64)
 }
 
 // Unique is a shortcut of `Client#WriteMetric(metricName, statsd.Int(value), statsd.Unique, 1)`.
@@ -363,9 +2243,36 @@ func (c *Client) Unique(metricName string, value int) error {
 	return c.WriteMetric(metricName, Int(value), Unique, 1)
 }
 
-// Time is a shortcut of `Client#WriteMetric(metricName, statsd.Duration(value), statsd.Time, 1)`.
+// UniqueString same as `Unique` but for a string "value", i.e an IP address or a user ID.
+// The value is hashed to a fixed-width token if the `WithSetHashing` is set,
+// otherwise it should not contain the metric line separators, i.e ':' and '|'.
+func (c *Client) UniqueString(metricName, value string) error {
+	if c != nil && c.setHash != nil {
+		value = c.setHash(value)
+	}
+
+	return c.WriteMetric(metricName, value, Unique, 1)
+}
+
+// fnvHash is the default hash of the `WithSetHashing`, the 64-bit FNV-1a hash of "value" as 16 hex characters.
+func fnvHash(value string) string {
+	h := fnv.New64a()
+	h.Write([]byte(value))
+
+	var b [8]byte
+	return hex.EncodeToString(h.Sum(b[:0]))
+}
+
+// Time is a shortcut of `Client#WriteMetric(metricName, statsd.Duration(value), statsd.Time, 1)`,
+// the rate can be customized through the `WithDefaultRate`.
 func (c *Client) Time(metricName string, value time.Duration) error {
-	return c.WriteMetric(metricName, Duration(value), Time, 1)
+	return c.writeDefault(metricName, Duration(value), Time, nil)
+}
+
+// TimeMicro same as `Time` but it writes the duration with microsecond precision,
+// see `DurationMicro` for details.
+func (c *Client) TimeMicro(metricName string, value time.Duration) error {
+	return c.writeDefault(metricName, DurationMicro(value), Time, nil)
 }
 
 // Record prepares a Timing metric which records a duration from now until the returned function is executed.
@@ -375,20 +2282,107 @@ func (c *Client) Time(metricName string, value time.Duration) error {
 // stop() // This will write the metric of Timing with value of start time - stop time.
 //
 // Extremely useful to capture http delays.
+//
+// The duration is measured with the monotonic clock, it is not affected by wall clock changes,
+// unless a custom clock is used, see `WithClock`.
 func (c *Client) Record(metricName string, rate float32) func() error {
-	start := time.Now()
+	start := c.now()
 	return func() error {
-		dur := time.Now().Sub(start)
+		dur := c.now().Sub(start) // monotonic.
 		return c.WriteMetric(metricName, Duration(dur), Time, rate)
 	}
 }
 
+// RecordFunc executes "fn" and writes a Timing metric of its execution duration.
+// The metric is written even if "fn" panics, the panic is propagated after that.
+// For example:
+// client.RecordFunc("db.query.time", 1, func() { db.Query(...) })
+func (c *Client) RecordFunc(metricName string, rate float32, fn func()) (err error) {
+	stop := c.Record(metricName, rate)
+	defer func() {
+		err = stop()
+	}()
+
+	fn()
+	return
+}
+
+// RecordContext same as `Record` but the returned function does not write the metric
+// if the "ctx" is done by the time it is executed, it returns the context's error instead.
+// Useful to not record the timing of canceled or timed out operations.
+func (c *Client) RecordContext(ctx context.Context, metricName string, rate float32) func() error {
+	stop := c.Record(metricName, rate)
+	return func() error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		return stop()
+	}
+}
+
+// RecordUntil same as `Record` but the Timing metric is written automatically when the "ctx" is done,
+// i.e a request's context, the duration is measured from the call until then.
+// The watcher goroutine exits without writing the metric if the client is closed first.
+func (c *Client) RecordUntil(ctx context.Context, metricName string, rate float32) {
+	if c.disabled() || c.IsClosed() {
+		return
+	}
+
+	stop := c.Record(metricName, rate)
+	go func() {
+		select {
+		case <-ctx.Done():
+			stop()
+		case <-c.done:
+		}
+	}()
+}
+
+// RecordAndCount same as `Record` but the returned function increments the "countName" counter too,
+// both metrics are written under a single lock, i.e the timing and the count of the requests:
+// stop := client.RecordAndCount("response.time", "requests")
+// next.ServeHTTP(w, r)
+// stop()
+//
+// The rates can be customized through the `WithDefaultRate`.
+func (c *Client) RecordAndCount(timeName, countName string) func() error {
+	start := c.now()
+	return func() error {
+		dur := c.now().Sub(start) // monotonic.
+
+		if c.disabled() {
+			return nil
+		}
+
+		if c.IsClosed() {
+			return ErrClosed
+		}
+
+		c.mu.Lock()
+		defer c.unlock()
+
+		if rate, ok := c.sampleDefault(Time); ok {
+			if err := c.writeMetric(timeName, Duration(dur), Time, rate, nil, 0); err != nil {
+				return err
+			}
+		}
+
+		if rate, ok := c.sampleDefault(Count); ok {
+			return c.writeMetric(countName, "1", Count, rate, nil, 0)
+		}
+
+		return nil
+	}
+}
+
 // Histogram writes a histogram metric value,
 // difference from `Time` metric type is that `Time` writes milleseconds.
 //
-// Histogram is a shortcut of `Client#WriteMetric(metricName, value, statsd.Histogram, 1)`.
+// Histogram is a shortcut of `Client#WriteMetric(metricName, value, statsd.Histogram, 1)`,
+// the rate can be customized through the `WithDefaultRate`.
 //
 // Read more at: https://docs.netdata.cloud/collectors/statsd.plugin/
 func (c *Client) Histogram(metricName string, value int) error {
-	return c.WriteMetric(metricName, Int(value), Histogram, 1)
+	return c.writeDefault(metricName, Int(value), Histogram, nil)
 }
@@ -2,8 +2,17 @@ package statsd
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"runtime"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -53,53 +62,65 @@ func TestClientWriteMetric(t *testing.T) {
 }
 
 func TestClientFlushEvery(t *testing.T) {
-	w := &ClosingBuffer{new(bytes.Buffer)}
-	client := NewClient(w, "")
+	clock := newFakeClock()
+	client := NewClientWriter(ioutil.Discard, "", WithClock(clock))
 	defer client.Close()
+
+	packets := make(chan string, 1)
+	client.OnFlush(func(payload []byte) { packets <- string(payload) })
+
+	expectFlush := func(expected string) {
+		t.Helper()
+		select {
+		case got := <-packets:
+			if got != expected {
+				t.Fatalf("expected other result here but got [%s]", got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected [%s] to be flushed", expected)
+		}
+	}
+
 	err := client.WriteMetric("my_metric", Int(1), Count, 1)
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	client.FlushEvery(2 * time.Second)
+	clock.Advance(time.Second)
 
-	if w.String() != "" {
-		t.Fatalf("should not Flush yet")
+	select {
+	case got := <-packets:
+		t.Fatalf("should not Flush yet but got [%s]", got)
+	case <-time.After(10 * time.Millisecond):
 	}
 
-	time.Sleep(3 * time.Second)
-
-	if got := w.String(); got != "my_metric:1|c" {
-		t.Fatalf("expected other result here but got [%s]", got)
-	}
+	clock.Advance(time.Second)
+	expectFlush("my_metric:1|c")
 
 	// test `Client#Flush` should not contain any old data.
-	w.Reset()
-
 	err = client.WriteMetric("my_metric2", Int(2), Count, 1)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	time.Sleep(3 * time.Second)
-
-	if got := w.String(); got != "my_metric2:2|c" { //
-		t.Fatalf("expected other result here but got [%s]", got)
-	}
+	clock.Advance(2 * time.Second)
+	expectFlush("my_metric2:2|c")
 }
 
 func TestClientRecord(t *testing.T) {
+	clock := newFakeClock()
 	w := &ClosingBuffer{new(bytes.Buffer)}
-	client := NewClient(w, "")
+	client := NewClient(w, "", WithClock(clock))
 	defer client.Close()
 
 	stop := client.Record("http.response.time", 1)
-	time.Sleep(1*time.Second + 100*time.Millisecond)
+	clock.Advance(1*time.Second + 100*time.Millisecond)
 	stop()
 	client.Flush(-1)
 
 	expected := "http.response.time:1100|ms"
-	if got := w.String(); len(got) != len(expected) {
+	if got := w.String(); got != expected {
 		t.Fatalf("expected other record time but got [%s]", got)
 	}
 }
@@ -143,3 +164,2011 @@ func BenchmarkClient(b *testing.B) {
 	}
 	client.Close()
 }
+
+func TestUDPWithBufferSize(t *testing.T) {
+	l, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	conn, err := UDPWithBufferSize(l.LocalAddr().String(), 1<<16)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewClient(conn, "")
+	client.Increment("my_metric")
+	client.Close()
+
+	buf := make([]byte, 64)
+	l.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := l.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := "my_metric:1|c", string(buf[:n]); expected != got {
+		t.Fatalf("expected to receive [%s] but got [%s]", expected, got)
+	}
+}
+
+func TestClientClosed(t *testing.T) {
+	w := &ClosingBuffer{new(bytes.Buffer)}
+	client := NewClient(w, "")
+	client.Close()
+
+	if err := client.Increment("my_metric"); err != ErrClosed {
+		t.Fatalf("expected WriteMetric to return ErrClosed but got: %v", err)
+	}
+
+	if err := client.Flush(-1); err != ErrClosed {
+		t.Fatalf("expected Flush to return ErrClosed but got: %v", err)
+	}
+
+	if err := client.FlushEvery(time.Second); err != ErrClosed {
+		t.Fatalf("expected FlushEvery to return ErrClosed but got: %v", err)
+	}
+}
+
+type countingWriter struct {
+	ClosingBuffer
+	writes int
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	w.writes++
+	return w.ClosingBuffer.Write(b)
+}
+
+func TestClientRateLimit(t *testing.T) {
+	w := &countingWriter{ClosingBuffer: ClosingBuffer{new(bytes.Buffer)}}
+	client := NewClient(w, "", WithRateLimit(5))
+	client.SetMaxPackageSize(16)
+
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		if err := client.Increment("my_metric"); err != nil {
+			t.Fatal(err)
+		}
+		client.Flush(-1)
+	}
+
+	// burst of 5 packets plus 5 packets per second.
+	if max := 5 + int(5*time.Since(start).Seconds()) + 1; w.writes > max {
+		t.Fatalf("expected at most %d packets but %d sent", max, w.writes)
+	}
+
+	if w.writes == 0 {
+		t.Fatalf("expected the first packets to be sent")
+	}
+
+	if client.Dropped() == 0 {
+		t.Fatalf("expected the oldest metrics to be dropped when the buffer is full")
+	}
+
+	if expected, got := 16*16, len(client.buf); got > expected {
+		t.Fatalf("expected buffer to not exceed %d bytes but got %d", expected, got)
+	}
+}
+
+func TestClientWriteRaw(t *testing.T) {
+	runTest(func(c *Client, w fmt.Stringer) {
+		c.SetFormatter(strings.ToUpper)
+
+		if err := c.WriteRaw("custom_metric:1|x|@0.5"); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := c.Increment("my_metric"); err != nil {
+			t.Fatal(err)
+		}
+
+		c.Flush(-1)
+
+		if expected, got := "custom_metric:1|x|@0.5\nmy_prefix.MY_METRIC:1|c", w.String(); expected != got {
+			t.Fatalf("expected:\n[%s]\nbut got:\n[%s]", expected, got)
+		}
+	})
+}
+
+func TestClientFlushCount(t *testing.T) {
+	w := &countingWriter{ClosingBuffer: ClosingBuffer{new(bytes.Buffer)}}
+	client := NewClient(w, "")
+	defer client.Close()
+	client.SetMaxPackageSize(16)
+
+	client.Flush(-1) // nothing to flush.
+	client.Increment("my_metric")
+	client.Increment("my_metric") // exceeds the packet size, flushes the first one.
+	client.Flush(-1)
+
+	if expected, got := uint64(2), client.FlushCount(); expected != got {
+		t.Fatalf("expected %d flushes but got %d", expected, got)
+	}
+
+	if expected, got := uint64(w.writes), client.PacketsSent(); expected != got {
+		t.Fatalf("expected %d packets but got %d", expected, got)
+	}
+}
+
+func TestClientSetPrefix(t *testing.T) {
+	runTest(func(c *Client, w fmt.Stringer) {
+		c.Increment("my_metric")
+		c.SetPrefix("other_prefix.")
+
+		if expected, got := "other_prefix.", c.Prefix(); expected != got {
+			t.Fatalf("expected prefix [%s] but got [%s]", expected, got)
+		}
+
+		if expected, got := "my_prefix.my_metric:1|c", w.String(); expected != got {
+			t.Fatalf("expected SetPrefix to flush [%s] but got [%s]", expected, got)
+		}
+
+		c.Increment("my_metric")
+		c.Flush(-1)
+
+		if expected, got := "my_prefix.my_metric:1|cother_prefix.my_metric:1|c", w.String(); expected != got {
+			t.Fatalf("expected:\n[%s]\nbut got:\n[%s]", expected, got)
+		}
+	})
+}
+
+func TestClientConfig(t *testing.T) {
+	client := NewClientWriter(ioutil.Discard, "my_prefix.", WithTagStyle(TagStyleGraphite))
+	defer client.Close()
+
+	expected := ClientConfig{Prefix: "my_prefix.", MaxPacketSize: defaultMaxPacketSize, TagStyle: TagStyleGraphite}
+	if got := client.Config(); expected != got {
+		t.Fatalf("expected %+v but got %+v", expected, got)
+	}
+
+	client.SetPrefix("other_prefix.")
+	client.SetMaxPackageSize(512)
+	client.SetFormatter(strings.ToUpper)
+	client.FlushEvery(time.Hour)
+
+	expected = ClientConfig{Prefix: "other_prefix.", MaxPacketSize: 512, FlushInterval: time.Hour, TagStyle: TagStyleGraphite, HasFormatter: true}
+	if got := client.Config(); expected != got {
+		t.Fatalf("expected %+v but got %+v", expected, got)
+	}
+
+	var nilClient *Client
+	if got := nilClient.Config(); got != (ClientConfig{}) {
+		t.Fatalf("expected the zero config of a nil client but got %+v", got)
+	}
+}
+
+func TestClientNegativeCount(t *testing.T) {
+	runTest(func(c *Client, w fmt.Stringer) {
+		if err := c.Count("my_metric", -5); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := c.WriteMetric("my_metric2", Float64(-0.5), Count, 0.5); err != nil {
+			t.Fatal(err)
+		}
+
+		c.Flush(-1)
+
+		if expected, got := "my_prefix.my_metric:-5|c\nmy_prefix.my_metric2:-0.5|c|@0.5", w.String(); expected != got {
+			t.Fatalf("expected:\n[%s]\nbut got:\n[%s]", expected, got)
+		}
+	})
+}
+
+func TestClientDefaultRate(t *testing.T) {
+	w := &ClosingBuffer{new(bytes.Buffer)}
+	client := NewClient(w, "", WithDefaultRate(Time, 0.25), WithRandSource(rand.NewSource(1)))
+	defer client.Close()
+
+	const writes = 100
+	for i := 0; i < writes; i++ {
+		client.Time("my_timer", 10*time.Millisecond)
+		client.Increment("my_counter")
+	}
+	client.Flush(-1)
+
+	out := w.String()
+	timers, counters := strings.Count(out, "my_timer:10|ms|@0.25"), strings.Count(out, "my_counter:1|c")
+
+	if timers == 0 || timers >= writes/2 {
+		t.Fatalf("expected about %d of the %d sampled timers to be kept but got %d", writes/4, writes, timers)
+	}
+
+	if counters != writes {
+		t.Fatalf("expected all the %d counters to be kept but got %d", writes, counters)
+	}
+}
+
+func TestClientOnFlush(t *testing.T) {
+	runTest(func(c *Client, w fmt.Stringer) {
+		var packets []string
+		c.OnFlush(func(payload []byte) {
+			packets = append(packets, string(payload))
+		})
+
+		c.SetMaxPackageSize(30)
+		c.Increment("my_metric")
+		c.Increment("my_metric2")
+		c.Flush(-1)
+
+		expected := []string{"my_prefix.my_metric:1|c", "my_prefix.my_metric2:1|c"}
+		if fmt.Sprint(expected) != fmt.Sprint(packets) {
+			t.Fatalf("expected %q but got %q", expected, packets)
+		}
+	})
+}
+
+type closeCounter struct {
+	ClosingBuffer
+	closes int32
+}
+
+func (w *closeCounter) Close() error {
+	atomic.AddInt32(&w.closes, 1)
+	return nil
+}
+
+func TestClientConcurrentClose(t *testing.T) {
+	w := &closeCounter{ClosingBuffer: ClosingBuffer{new(bytes.Buffer)}}
+	client := NewClient(w, "")
+	client.FlushEvery(time.Millisecond)
+	client.Increment("my_metric")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client.Close()
+		}()
+	}
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&w.closes); got != 1 {
+		t.Fatalf("expected the writer to be closed once but closed %d times", got)
+	}
+}
+
+func TestClientFlushEveryGoroutines(t *testing.T) {
+	numGoroutines := func(expected int) int {
+		// give some time to the stopped goroutines to return.
+		n := runtime.NumGoroutine()
+		for i := 0; i < 100 && n > expected; i++ {
+			time.Sleep(time.Millisecond)
+			n = runtime.NumGoroutine()
+		}
+		return n
+	}
+
+	before := runtime.NumGoroutine()
+
+	client := NewClient(&ClosingBuffer{new(bytes.Buffer)}, "")
+	for i := 0; i < 10; i++ {
+		client.FlushEvery(time.Millisecond)
+	}
+
+	if got := numGoroutines(before + 1); got != before+1 {
+		t.Fatalf("expected %d goroutines but got %d", before+1, got)
+	}
+
+	client.Close()
+
+	if got := numGoroutines(before); got != before {
+		t.Fatalf("expected %d goroutines after Close but got %d", before, got)
+	}
+}
+
+func TestNewClientWriter(t *testing.T) {
+	w := new(bytes.Buffer)
+	client := NewClientWriter(w, "my_prefix.")
+	client.Increment("my_metric")
+
+	if err := client.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := "my_prefix.my_metric:1|c", w.String(); expected != got {
+		t.Fatalf("expected [%s] but got [%s]", expected, got)
+	}
+}
+
+func TestAppendMetric(t *testing.T) {
+	dst := AppendMetric([]byte("previous\n"), "my_prefix.", "my_metric", Int(-10), Gauge, 0.5)
+
+	if expected, got := "previous\nmy_prefix.my_metric:-10|g|@0.5\n", string(dst); expected != got {
+		t.Fatalf("expected [%s] but got [%s]", expected, got)
+	}
+}
+
+func TestClientFraming(t *testing.T) {
+	tests := []struct {
+		mode     FramingMode
+		expected string
+	}{
+		{FramingUDP, "my_metric:1|cmy_metric2:1|c\nmy_metric3:1|c"},
+		{FramingStream, "my_metric:1|c\nmy_metric2:1|c\nmy_metric3:1|c\n"},
+	}
+
+	for i, tt := range tests {
+		w := new(bytes.Buffer)
+		client := NewClientWriter(w, "", WithFraming(tt.mode))
+
+		client.Increment("my_metric")
+		client.Flush(-1)
+		client.Increment("my_metric2")
+		client.Increment("my_metric3")
+		client.Close()
+
+		if got := w.String(); tt.expected != got {
+			t.Fatalf("[%d] expected:\n[%q]\nbut got:\n[%q]", i, tt.expected, got)
+		}
+	}
+}
+
+func BenchmarkClientOnFlush(b *testing.B) {
+	const testMetricName = "my_test_metric"
+	client := NewClientWriter(ioutil.Discard, "")
+	client.SetMaxPackageSize(64)
+	client.OnFlush(func(payload []byte) {})
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		client.WriteMetric(testMetricName, Int(i), Count, 1)
+		client.WriteMetric(testMetricName, Int(i), Gauge, 1)
+		client.WriteMetric(testMetricName, Int(i), Time, 1)
+	}
+	client.Close()
+}
+
+// BenchmarkFlushCopy compares the pooled copies of the flushed packets, see `OnFlush`,
+// with a naive copy per packet.
+func BenchmarkFlushCopy(b *testing.B) {
+	payload := bytes.Repeat([]byte("my_test_metric:1|c\n"), 64)
+	fn := func(payload []byte) {}
+
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			p := getBuffer()
+			*p = append(*p, payload...)
+			fn(*p)
+			putBuffer(p)
+		}
+	})
+
+	b.Run("naive", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			p := append([]byte(nil), payload...)
+			fn(p)
+		}
+	})
+}
+
+func TestClientWriteMetricMulti(t *testing.T) {
+	runTest(func(c *Client, w fmt.Stringer) {
+		c.SetMaxPackageSize(32)
+		c.Increment("my_metric")
+
+		// larger than the packet size, it flushes the previous metrics and it is sent alone.
+		values := []string{"100", "200", "300", "400", "500", "600"}
+		if err := c.WriteMetricMulti("my_timer", values, Time, 0.5); err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, got := "my_prefix.my_metric:1|c", w.String(); expected != got {
+			t.Fatalf("expected [%s] but got [%s]", expected, got)
+		}
+
+		c.Flush(-1)
+
+		if expected, got := "my_prefix.my_metric:1|cmy_prefix.my_timer:100:200:300:400:500:600|ms|@0.5", w.String(); expected != got {
+			t.Fatalf("expected [%s] but got [%s]", expected, got)
+		}
+	})
+}
+
+func TestClientRemoteAddr(t *testing.T) {
+	conn, err := UDP("127.0.0.1:8125")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewClient(conn, "")
+	defer client.Close()
+
+	if expected, got := "127.0.0.1:8125", fmt.Sprint(client.RemoteAddr()); expected != got {
+		t.Fatalf("expected remote address [%s] but got [%s]", expected, got)
+	}
+
+	if addr := NewClientWriter(new(bytes.Buffer), "").RemoteAddr(); addr != nil {
+		t.Fatalf("expected nil remote address but got [%s]", addr)
+	}
+}
+
+func TestClientNegativeGaugeStrategy(t *testing.T) {
+	tests := []struct {
+		strategy NegativeGaugeStrategy
+		expected string
+	}{
+		{NegativeGaugeReset, "my_gauge:0|g\nmy_gauge:-10|g\nmy_gauge:5|g"},
+		{NegativeGaugeClamp, "my_gauge:0|g\nmy_gauge:5|g"},
+		{NegativeGaugeRaw, "my_gauge:-10|g\nmy_gauge:5|g"},
+	}
+
+	for i, tt := range tests {
+		w := new(bytes.Buffer)
+		client := NewClientWriter(w, "", WithNegativeGaugeStrategy(tt.strategy))
+		client.Gauge("my_gauge", -10)
+		client.Gauge("my_gauge", 5)
+		client.Close()
+
+		if got := w.String(); tt.expected != got {
+			t.Fatalf("[%d] expected:\n[%s]\nbut got:\n[%s]", i, tt.expected, got)
+		}
+	}
+}
+
+func TestClientRawNegativeGauges(t *testing.T) {
+	tests := []struct {
+		opts     []Option
+		expected string
+	}{
+		{nil, "my_gauge:0|g\nmy_gauge:-10|g"},
+		{[]Option{WithRawNegativeGauges()}, "my_gauge:-10|g"},
+	}
+
+	for i, tt := range tests {
+		w := new(bytes.Buffer)
+		client := NewClientWriter(w, "", tt.opts...)
+		client.Gauge("my_gauge", -10)
+		client.Close()
+
+		if got := w.String(); tt.expected != got {
+			t.Fatalf("[%d] expected:\n[%s]\nbut got:\n[%s]", i, tt.expected, got)
+		}
+	}
+}
+
+func TestClientInvalidRate(t *testing.T) {
+	w := new(bytes.Buffer)
+	client := NewClientWriter(w, "")
+	for _, rate := range []float32{0, 2, -0.5} {
+		if err := client.WriteMetric("my_metric", "1", Count, rate); err != nil {
+			t.Fatal(err)
+		}
+	}
+	client.Close()
+
+	if expected, got := "my_metric:1|c\nmy_metric:1|c\nmy_metric:1|c", w.String(); expected != got {
+		t.Fatalf("expected:\n[%s]\nbut got:\n[%s]", expected, got)
+	}
+
+	w.Reset()
+	client = NewClientWriter(w, "", WithStrict())
+	if err := client.WriteMetric("my_metric", "1", Count, 0); err != nil {
+		t.Fatalf("expected rate 0 to be written as the default rate but got: %v", err)
+	}
+
+	for _, rate := range []float32{2, -0.5} {
+		if err := client.WriteMetric("my_metric", "1", Count, rate); err != ErrInvalidRate {
+			t.Fatalf("expected ErrInvalidRate for rate %v but got: %v", rate, err)
+		}
+	}
+	client.Close()
+
+	if expected, got := "my_metric:1|c", w.String(); expected != got {
+		t.Fatalf("expected:\n[%s]\nbut got:\n[%s]", expected, got)
+	}
+}
+
+func TestClientRegisterGauge(t *testing.T) {
+	client := NewClientWriter(ioutil.Discard, "")
+	defer client.Close()
+
+	packets := make(chan string, 10)
+	client.OnFlush(func(payload []byte) { packets <- string(payload) })
+
+	var connections int32 = 2
+	client.RegisterGauge("connections", func() int { return int(atomic.AddInt32(&connections, 1)) })
+	client.RegisterGauge("other", func() int { return 0 })
+	client.RegisterGauge("other", nil)
+	client.FlushEvery(10 * time.Millisecond)
+
+	for _, expected := range []string{"connections:3|g", "connections:4|g"} {
+		select {
+		case got := <-packets:
+			if expected != got {
+				t.Fatalf("expected [%s] but got [%s]", expected, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected [%s] to be flushed", expected)
+		}
+	}
+}
+
+func TestClientTimeMicro(t *testing.T) {
+	w := new(bytes.Buffer)
+	client := NewClientWriter(w, "")
+	client.TimeMicro("my_timer", 300*time.Microsecond)
+	client.TimeMicro("my_timer", 1234567*time.Nanosecond)
+	client.Time("my_timer", 300*time.Microsecond)
+	client.Close()
+
+	if expected, got := "my_timer:0.3|ms\nmy_timer:1.234|ms\nmy_timer:0|ms", w.String(); expected != got {
+		t.Fatalf("expected:\n[%s]\nbut got:\n[%s]", expected, got)
+	}
+}
+
+type failingWriter struct {
+	ClosingBuffer
+	fail bool
+}
+
+var errWrite = fmt.Errorf("write failed")
+
+func (w *failingWriter) Write(b []byte) (int, error) {
+	if w.fail {
+		return 0, errWrite
+	}
+
+	return w.ClosingBuffer.Write(b)
+}
+
+// shortWriter writes at most "max" bytes per write, it fails after the short write if "fail" is set.
+type shortWriter struct {
+	ClosingBuffer
+	max  int
+	fail bool
+}
+
+func (w *shortWriter) Write(b []byte) (int, error) {
+	if len(b) <= w.max {
+		return w.ClosingBuffer.Write(b)
+	}
+
+	n, _ := w.ClosingBuffer.Write(b[:w.max])
+	if w.fail {
+		return n, errWrite
+	}
+
+	return n, nil
+}
+
+func TestClientShortWrites(t *testing.T) {
+	expected := "my_metric:1|c\nmy_metric2:2|c\n"
+
+	w := &shortWriter{ClosingBuffer: ClosingBuffer{new(bytes.Buffer)}, max: 5}
+	client := NewClient(w, "", WithFraming(FramingStream))
+	client.Count("my_metric", 1)
+	client.Count("my_metric2", 2)
+
+	if err := client.Flush(-1); err != nil {
+		t.Fatal(err)
+	}
+	if got := w.String(); expected != got {
+		t.Fatalf("expected [%s] but got [%s]", expected, got)
+	}
+
+	// the written head is not retried on a failed short write.
+	w = &shortWriter{ClosingBuffer: ClosingBuffer{new(bytes.Buffer)}, max: 5, fail: true}
+	client = NewClient(w, "", WithFraming(FramingStream))
+	client.Count("my_metric", 1)
+	client.Count("my_metric2", 2)
+
+	if err := client.Flush(-1); err != errWrite {
+		t.Fatalf("expected the write error but got %v", err)
+	}
+
+	w.fail = false
+	if err := client.Flush(-1); err != nil {
+		t.Fatal(err)
+	}
+	if got := w.String(); expected != got {
+		t.Fatalf("expected [%s] but got [%s]", expected, got)
+	}
+
+	// a short datagram is not completed, it is retried in full.
+	w = &shortWriter{ClosingBuffer: ClosingBuffer{new(bytes.Buffer)}, max: 5}
+	client = NewClient(w, "")
+	client.Count("my_metric", 1)
+
+	if err := client.Flush(-1); err != io.ErrShortWrite {
+		t.Fatalf("expected io.ErrShortWrite but got %v", err)
+	}
+	if got := client.buf; string(got) != "my_metric:1|c\n" {
+		t.Fatalf("expected the metric to be kept but got [%s]", got)
+	}
+}
+
+func TestClientMaxBufferBytes(t *testing.T) {
+	w := &failingWriter{ClosingBuffer: ClosingBuffer{new(bytes.Buffer)}, fail: true}
+	client := NewClient(w, "", WithMaxBufferBytes(64), WithFraming(FramingStream))
+	client.SetMaxPackageSize(32)
+
+	for i := 0; i < 10; i++ {
+		client.Count("my_metric", i) // 14 bytes each.
+	}
+
+	if got := len(client.buf); got > 64 {
+		t.Fatalf("expected buffer to not exceed 64 bytes but got %d", got)
+	}
+
+	if expected, got := uint64(6), client.Dropped(); expected != got {
+		t.Fatalf("expected %d dropped metrics but got %d", expected, got)
+	}
+
+	w.fail = false
+	client.Flush(-1)
+
+	if expected, got := "my_metric:6|c\nmy_metric:7|c\nmy_metric:8|c\nmy_metric:9|c\n", w.String(); expected != got {
+		t.Fatalf("expected the newest metrics:\n[%s]\nbut got:\n[%s]", expected, got)
+	}
+}
+
+func TestClientRecordContext(t *testing.T) {
+	w := new(bytes.Buffer)
+	client := NewClientWriter(w, "")
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stop := client.RecordContext(ctx, "my_timer", 1)
+	time.Sleep(50 * time.Millisecond)
+	if err := stop(); err != nil {
+		t.Fatal(err)
+	}
+	client.Flush(-1)
+
+	got := strings.TrimSuffix(strings.TrimPrefix(w.String(), "my_timer:"), "|ms")
+	ms, err := strconv.Atoi(got)
+	if err != nil {
+		t.Fatalf("expected a timing metric but got [%s]", w.String())
+	}
+
+	if ms < 50 || ms > 250 {
+		t.Fatalf("expected a duration of about 50ms but got %dms", ms)
+	}
+
+	w.Reset()
+	stop = client.RecordContext(ctx, "my_timer", 1)
+	cancel()
+	if err = stop(); err != context.Canceled {
+		t.Fatalf("expected context.Canceled but got: %v", err)
+	}
+	client.Flush(-1)
+
+	if got := w.String(); got != "" {
+		t.Fatalf("expected no metric for a canceled context but got [%s]", got)
+	}
+}
+
+func TestClientRecordAndCount(t *testing.T) {
+	clock := newFakeClock()
+	w := new(bytes.Buffer)
+	client := NewClientWriter(w, "my_prefix.", WithClock(clock))
+	defer client.Close()
+
+	stop := client.RecordAndCount("response.time", "requests")
+	clock.Advance(42 * time.Millisecond)
+	if err := stop(); err != nil {
+		t.Fatal(err)
+	}
+	client.Flush(-1)
+
+	if expected, got := "my_prefix.response.time:42|ms\nmy_prefix.requests:1|c", w.String(); expected != got {
+		t.Fatalf("expected:\n[%s]\nbut got:\n[%s]", expected, got)
+	}
+}
+
+func TestClientRecordFunc(t *testing.T) {
+	w := new(bytes.Buffer)
+	client := NewClientWriter(w, "")
+	defer client.Close()
+
+	if err := client.RecordFunc("my_func", 1, func() {}); err != nil {
+		t.Fatal(err)
+	}
+
+	func() {
+		defer func() {
+			if r := recover(); r != "boom" {
+				t.Fatalf("expected the panic to be propagated but got: %v", r)
+			}
+		}()
+
+		client.RecordFunc("my_panic", 1, func() { panic("boom") })
+	}()
+
+	client.Flush(-1)
+
+	if expected, got := "my_func:0|ms\nmy_panic:0|ms", w.String(); expected != got {
+		t.Fatalf("expected:\n[%s]\nbut got:\n[%s]", expected, got)
+	}
+}
+
+func TestClientMaxPacketSize(t *testing.T) {
+	for _, mode := range []FramingMode{FramingUDP, FramingStream} {
+		client := NewClientWriter(ioutil.Discard, "", WithFraming(mode))
+		client.SetMaxPackageSize(40)
+
+		var packets []string
+		client.OnFlush(func(payload []byte) { packets = append(packets, string(payload)) })
+
+		for i := 0; i < 100; i++ {
+			client.Count("my_metric", i*i) // variable sizes.
+		}
+		client.Close()
+
+		if len(packets) < 2 {
+			t.Fatalf("expected more than one packet but got %d", len(packets))
+		}
+
+		for i, p := range packets {
+			if len(p) > 40 {
+				t.Fatalf("[%d] packet of %d bytes exceeds the max packet size: [%s]", i, len(p), p)
+			}
+		}
+
+		// the packets should be filled: the next metric would have exceed the size.
+		first := packets[0]
+		if next := strings.SplitN(packets[1], "\n", 2)[0]; len(first)+1+len(next) <= 40 {
+			t.Fatalf("expected [%s] to be part of the first packet [%s]", next, first)
+		}
+	}
+}
+
+func TestClientWriteMetricAt(t *testing.T) {
+	w := new(bytes.Buffer)
+	client := NewClientWriter(w, "", WithGlobalTags("env:dev"))
+	at := time.Date(2019, 4, 16, 0, 0, 0, 0, time.UTC)
+	if err := client.WriteMetricAt("my_metric", "1", Count, 0.5, at); err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+
+	if expected, got := "my_metric:1|c|@0.5|#env:dev|T1555372800", w.String(); expected != got {
+		t.Fatalf("expected [%s] but got [%s]", expected, got)
+	}
+}
+
+func TestClientFlushSync(t *testing.T) {
+	w := new(bytes.Buffer)
+	client := NewClientWriter(w, "")
+	defer client.Close()
+	client.FlushEvery(time.Hour)
+
+	var expected []string
+	for i := 0; i < 200; i++ {
+		client.Count("my_metric", i)
+		expected = append(expected, "my_metric:"+strconv.Itoa(i)+"|c")
+	}
+
+	if err := client.Flush(-1); err != nil {
+		t.Fatal(err)
+	}
+
+	// packets are written without the last new line.
+	got := strings.Replace(w.String(), "|cmy_metric", "|c\nmy_metric", -1)
+	if exp := strings.Join(expected, "\n"); exp != got {
+		t.Fatalf("expected all metrics to be written on Flush but got:\n[%s]", got)
+	}
+}
+
+func TestClientGaugeRate(t *testing.T) {
+	w := new(bytes.Buffer)
+	client := NewClientWriter(w, "")
+	client.GaugeRate("my_gauge", 10, 0.5)
+	client.GaugeRate("my_gauge", -10, 0.5)
+	client.Close()
+
+	if expected, got := "my_gauge:10|g|@0.5\nmy_gauge:0|g|@0.5\nmy_gauge:-10|g|@0.5", w.String(); expected != got {
+		t.Fatalf("expected:\n[%s]\nbut got:\n[%s]", expected, got)
+	}
+}
+
+func TestClientFlushRetry(t *testing.T) {
+	w := &failingWriter{ClosingBuffer: ClosingBuffer{new(bytes.Buffer)}, fail: true}
+	client := NewClient(w, "")
+	defer client.Close()
+
+	client.Increment("my_metric")
+	if err := client.Flush(-1); err != errWrite {
+		t.Fatalf("expected the write error but got: %v", err)
+	}
+
+	client.Increment("my_metric2")
+	w.fail = false
+	if err := client.Flush(-1); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := "my_metric:1|c\nmy_metric2:1|c", w.String(); expected != got {
+		t.Fatalf("expected the failed metrics to be retried:\n[%s]\nbut got:\n[%s]", expected, got)
+	}
+}
+
+func TestClientFlushEveryN(t *testing.T) {
+	client := NewClientWriter(ioutil.Discard, "", WithFlushEveryN(3))
+	client.SetMaxPackageSize(40)
+
+	var packets []string
+	client.OnFlush(func(payload []byte) { packets = append(packets, string(payload)) })
+
+	client.Increment("a")
+	client.Increment("b")
+	client.Flush(-1) // resets the counter.
+	client.Increment("c")
+	client.Increment("d")
+	client.Increment("e")
+	client.Count("long_metric_name_1", 1)
+	client.Count("long_metric_name_2", 1) // the packet size flushes the first one.
+	client.Increment("f")
+	client.Increment("g")
+
+	expected := []string{
+		"a:1|c\nb:1|c",
+		"c:1|c\nd:1|c\ne:1|c",
+		"long_metric_name_1:1|c",
+		"long_metric_name_2:1|c\nf:1|c\ng:1|c",
+	}
+	if fmt.Sprint(expected) != fmt.Sprint(packets) {
+		t.Fatalf("expected %q but got %q", expected, packets)
+	}
+}
+
+func TestClientGauges(t *testing.T) {
+	w := new(bytes.Buffer)
+	client := NewClientWriter(w, "", WithFraming(FramingStream))
+	err := client.Gauges(map[string]int{"a": 1, "b": -2, "c": 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+
+	if expected, got := "a:1|g\nb:0|g\nb:-2|g\nc:3|g\n", w.String(); expected != got {
+		t.Fatalf("expected:\n[%s]\nbut got:\n[%s]", expected, got)
+	}
+}
+
+func TestClientFlushIfPending(t *testing.T) {
+	w := &failingWriter{ClosingBuffer: ClosingBuffer{new(bytes.Buffer)}}
+	client := NewClient(w, "")
+
+	if flushed, err := client.FlushIfPending(); flushed || err != nil {
+		t.Fatalf("expected nothing to flush but got flushed: %v, err: %v", flushed, err)
+	}
+
+	client.Increment("my_metric")
+	w.fail = true
+	if flushed, err := client.FlushIfPending(); flushed || err != errWrite {
+		t.Fatalf("expected a failed flush but got flushed: %v, err: %v", flushed, err)
+	}
+
+	w.fail = false
+	if flushed, err := client.FlushIfPending(); !flushed || err != nil {
+		t.Fatalf("expected a flush but got flushed: %v, err: %v", flushed, err)
+	}
+
+	if expected, got := "my_metric:1|c", w.String(); expected != got {
+		t.Fatalf("expected [%s] but got [%s]", expected, got)
+	}
+}
+
+func TestClientFlushIfPendingAggregates(t *testing.T) {
+	w := &ClosingBuffer{new(bytes.Buffer)}
+	client := NewClient(w, "", WithSwapFlush())
+	defer client.Close()
+
+	client.Accumulate("my_counter", 2)
+	if flushed, err := client.FlushIfPending(); !flushed || err != nil {
+		t.Fatalf("expected a flush but got flushed: %v, err: %v", flushed, err)
+	}
+
+	if expected, got := "my_counter:2|c", w.String(); expected != got {
+		t.Fatalf("expected [%s] but got [%s]", expected, got)
+	}
+}
+
+func TestClientAutoDot(t *testing.T) {
+	tests := []struct {
+		prefix   string
+		opts     []Option
+		expected string
+	}{
+		{"app", nil, "appmy_metric:1|c"},
+		{"app", []Option{WithAutoDot()}, "app.my_metric:1|c"},
+		{"app.", []Option{WithAutoDot()}, "app.my_metric:1|c"},
+		{"", []Option{WithAutoDot()}, "my_metric:1|c"},
+	}
+
+	for i, tt := range tests {
+		w := new(bytes.Buffer)
+		client := NewClientWriter(w, tt.prefix, tt.opts...)
+		client.Increment("my_metric")
+		client.Close()
+
+		if got := w.String(); tt.expected != got {
+			t.Fatalf("[%d] expected [%s] but got [%s]", i, tt.expected, got)
+		}
+	}
+
+	w := new(bytes.Buffer)
+	client := NewClientWriter(w, "", WithAutoDot())
+	client.SetPrefix("other")
+	client.Increment(".my_metric")
+	client.Close()
+
+	if expected, got := "other.my_metric:1|c", w.String(); expected != got {
+		t.Fatalf("expected [%s] but got [%s]", expected, got)
+	}
+}
+
+func TestClientAdditionalPrefix(t *testing.T) {
+	var packets []string
+	client := NewClientWriter(ioutil.Discard, "prod.", WithAdditionalPrefix("canary."))
+	client.OnFlush(func(payload []byte) { packets = append(packets, string(payload)) })
+	client.SetMaxPackageSize(len("prod.my_metric:1|c\ncanary.my_metric:1|c"))
+
+	client.Increment("my_metric")
+	client.Increment("my_metric")
+	client.Close()
+
+	expected := "prod.my_metric:1|c\ncanary.my_metric:1|c"
+	if len(packets) != 2 || packets[0] != expected || packets[1] != expected {
+		t.Fatalf("expected two packets of [%s] but got %q", expected, packets)
+	}
+}
+
+func TestClientAdditionalPrefixAutoDot(t *testing.T) {
+	for _, opts := range [][]Option{
+		{WithAutoDot(), WithAdditionalPrefix("canary")},
+		{WithAdditionalPrefix("canary"), WithAutoDot()},
+	} {
+		w := new(bytes.Buffer)
+		client := NewClientWriter(w, "app", opts...)
+		client.Increment("m")
+		client.Close()
+
+		if expected, got := "app.m:1|c\ncanary.m:1|c", w.String(); expected != got {
+			t.Fatalf("expected:\n[%s]\nbut got:\n[%s]", expected, got)
+		}
+	}
+}
+
+func TestClientFloatFormat(t *testing.T) {
+	tests := []struct {
+		opts     []Option
+		expected string
+	}{
+		{nil, "my_gauge:0.0000001|g"},
+		{[]Option{WithFloatFormat('g', -1)}, "my_gauge:1e-07|g"},
+		{[]Option{WithFloatFormat('f', 3)}, "my_gauge:0.000|g"},
+	}
+
+	for i, tt := range tests {
+		w := new(bytes.Buffer)
+		client := NewClientWriter(w, "", tt.opts...)
+		client.GaugeFloat64("my_gauge", 0.0000001)
+		client.Close()
+
+		if got := w.String(); tt.expected != got {
+			t.Fatalf("[%d] expected [%s] but got [%s]", i, tt.expected, got)
+		}
+	}
+}
+
+func TestClientMinFill(t *testing.T) {
+	clock := newFakeClock()
+	client := NewClientWriter(ioutil.Discard, "", WithClock(clock), WithMinFill(0.5, 3*time.Second))
+	client.SetMaxPackageSize(100)
+
+	packets := make(chan string, 2)
+	client.OnFlush(func(payload []byte) { packets <- string(payload) })
+
+	expectFlush := func(expected string) {
+		t.Helper()
+		select {
+		case got := <-packets:
+			if got != expected {
+				t.Fatalf("expected [%s] but got [%s]", expected, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected [%s] to be flushed", expected)
+		}
+	}
+
+	expectNoFlush := func() {
+		t.Helper()
+		select {
+		case got := <-packets:
+			t.Fatalf("should not flush yet but got [%s]", got)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	client.Increment("my_metric")
+	client.FlushEvery(time.Second)
+
+	for i := 0; i < 3; i++ {
+		clock.Advance(time.Second)
+		expectNoFlush()
+	}
+
+	// max deferral reached.
+	clock.Advance(time.Second)
+	expectFlush("my_metric:1|c")
+
+	long := strings.Repeat("a", 50)
+	client.Increment(long)
+	clock.Advance(time.Second)
+	expectFlush(long + ":1|c")
+
+	client.Increment("my_metric")
+	clock.Advance(time.Second)
+	expectNoFlush()
+
+	client.Close()
+	expectFlush("my_metric:1|c")
+}
+
+func TestClientCopyFrom(t *testing.T) {
+	var packets []string
+	client := NewClientWriter(ioutil.Discard, "")
+	client.OnFlush(func(payload []byte) { packets = append(packets, string(payload)) })
+	client.SetMaxPackageSize(len("a:1|c\nb:2|g"))
+
+	n, err := client.CopyFrom(strings.NewReader("a:1|c\n\nb:2|g\r\nc:3|ms"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := 3; expected != n {
+		t.Fatalf("expected %d lines but got %d", expected, n)
+	}
+
+	client.Close()
+	if expected, got := "a:1|c\nb:2|g c:3|ms", strings.Join(packets, " "); expected != got {
+		t.Fatalf("expected [%s] but got [%s]", expected, got)
+	}
+
+	if _, err = client.CopyFrom(strings.NewReader("a:1|c")); err != ErrClosed {
+		t.Fatalf("expected ErrClosed but got %v", err)
+	}
+}
+
+func TestClientWriteBatch(t *testing.T) {
+	var packets []string
+	client := NewClientWriter(ioutil.Discard, "my_prefix.")
+	client.SetFormatter(strings.ToUpper) // not applied.
+	client.OnFlush(func(payload []byte) { packets = append(packets, string(payload)) })
+	client.SetMaxPackageSize(len("a:1|c\nb:2|g"))
+
+	if err := client.WriteBatch([]byte("a:1|c\n\nb:2|g\r\nc:3|ms\nd:4|c\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	client.Close()
+	if expected, got := "a:1|c\nb:2|g c:3|ms d:4|c", strings.Join(packets, " "); expected != got {
+		t.Fatalf("expected [%s] but got [%s]", expected, got)
+	}
+
+	if err := client.WriteBatch([]byte("a:1|c")); err != ErrClosed {
+		t.Fatalf("expected ErrClosed but got %v", err)
+	}
+}
+
+func TestClientClearFormatter(t *testing.T) {
+	w := new(bytes.Buffer)
+	client := NewClientWriter(w, "", WithFraming(FramingStream))
+
+	client.SetFormatter(strings.ToUpper)
+	client.Increment("my_metric")
+	client.ClearFormatter()
+	client.Increment("my_metric")
+	client.SetFormatter(strings.ToUpper)
+	client.SetFormatter(nil)
+	client.Increment("my_metric2")
+	client.Close()
+
+	if expected, got := "MY_METRIC:1|c\nmy_metric:1|c\nmy_metric2:1|c\n", w.String(); expected != got {
+		t.Fatalf("expected:\n[%s]\nbut got:\n[%s]", expected, got)
+	}
+}
+
+func TestClientWriteMetricTyped(t *testing.T) {
+	w := new(bytes.Buffer)
+	client := NewClientWriter(w, "")
+
+	if err := client.WriteMetricTyped("my_metric", "1", Count, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.WriteMetricTyped("my_metric", "1", MetricType("d"), 1); err != ErrInvalidType {
+		t.Fatalf("expected ErrInvalidType but got %v", err)
+	}
+
+	// the untyped constants are still accepted by the string based methods.
+	if err := client.WriteMetric("my_metric2", "1", Gauge, 1); err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+
+	if expected, got := "my_metric:1|c\nmy_metric2:1|g", w.String(); expected != got {
+		t.Fatalf("expected [%s] but got [%s]", expected, got)
+	}
+}
+
+func TestClientSelfMetrics(t *testing.T) {
+	clock := newFakeClock()
+	client := NewClientWriter(ioutil.Discard, "my_prefix.", WithClock(clock), WithSelfMetrics("statsd.client."))
+	defer client.Close()
+
+	packets := make(chan string, 1)
+	client.OnFlush(func(payload []byte) { packets <- string(payload) })
+
+	client.Increment("my_metric")
+	client.FlushEvery(time.Second)
+
+	expect := func(expected string) {
+		t.Helper()
+		select {
+		case got := <-packets:
+			if got != expected {
+				t.Fatalf("expected:\n[%s]\nbut got:\n[%s]", expected, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected [%s] to be flushed", expected)
+		}
+	}
+
+	clock.Advance(time.Second)
+	expect("my_prefix.my_metric:1|c\nstatsd.client.buffered_bytes:24|g\nstatsd.client.flushes:0|g\nstatsd.client.packets:0|g\nstatsd.client.dropped:0|g")
+
+	clock.Advance(time.Second)
+	expect("statsd.client.buffered_bytes:0|g\nstatsd.client.flushes:1|g\nstatsd.client.packets:1|g\nstatsd.client.dropped:0|g")
+}
+
+func TestClientGaugeDelta(t *testing.T) {
+	w := new(bytes.Buffer)
+	client := NewClientWriter(w, "", WithFraming(FramingStream))
+	client.GaugeDelta("my_gauge", 2)
+	client.GaugeDelta("my_gauge", -2)
+	client.GaugeDeltaFloat("my_gauge", 1.5)
+	client.GaugeDeltaFloat("my_gauge", -0.25)
+	client.GaugeDeltaFloat("my_gauge", 0)
+	client.Close()
+
+	expected := "my_gauge:+2|g\nmy_gauge:-2|g\nmy_gauge:+1.5|g\nmy_gauge:-0.25|g\nmy_gauge:+0|g\n"
+	if got := w.String(); expected != got {
+		t.Fatalf("expected:\n[%s]\nbut got:\n[%s]", expected, got)
+	}
+}
+
+func TestClientMaxNameLength(t *testing.T) {
+	w := new(bytes.Buffer)
+	client := NewClientWriter(w, "app.", WithMaxNameLength(10))
+	client.Increment("short")
+	client.Increment("my_very_long_metric")
+	client.Close()
+
+	if expected, got := "app.short:1|c\napp.my_ver:1|c", w.String(); expected != got {
+		t.Fatalf("expected:\n[%s]\nbut got:\n[%s]", expected, got)
+	}
+
+	client = NewClientWriter(ioutil.Discard, "app.", WithMaxNameLength(10), WithStrict())
+	defer client.Close()
+
+	if err := client.Increment("my_very_long_metric"); err != ErrNameTooLong {
+		t.Fatalf("expected ErrNameTooLong but got %v", err)
+	}
+}
+
+func TestClientMaxNameLengthPrefixes(t *testing.T) {
+	w := new(bytes.Buffer)
+	client := NewClientWriter(w, "app.", WithMaxNameLength(9), WithAdditionalPrefix("canary."), WithFraming(FramingStream))
+	client.Increment("my_very_long_metric")
+	client.Increment("métrique") // the "é" is not split.
+	client.Close()
+
+	expected := "app.my:1|c\ncanary.my:1|c\napp.m:1|c\ncanary.m:1|c\n"
+	if got := w.String(); expected != got {
+		t.Fatalf("expected:\n[%s]\nbut got:\n[%s]", expected, got)
+	}
+}
+
+func TestClientWriteMetricFlushed(t *testing.T) {
+	client := NewClientWriter(ioutil.Discard, "")
+	client.SetMaxPackageSize(len("my_metric:1|c\nmy_metric:1|c"))
+	defer client.Close()
+
+	for i, expected := range []bool{false, false, true, false} {
+		flushed, err := client.WriteMetricFlushed("my_metric", "1", Count, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected != flushed {
+			t.Fatalf("[%d] expected flushed: %v but got %v", i, expected, flushed)
+		}
+	}
+}
+
+func TestClientNegativeGaugeFormatter(t *testing.T) {
+	w := new(bytes.Buffer)
+	client := NewClientWriter(w, "my_prefix.", WithAdditionalPrefix("canary."))
+	// the formatter is applied once, for both the zero-reset and the value.
+	client.SetFormatter(func(metricName string) string { return metricName + "_total" })
+	client.Gauge("my_gauge", -10)
+	client.Close()
+
+	expected := "my_prefix.my_gauge_total:0|g\ncanary.my_gauge_total:0|g\nmy_prefix.my_gauge_total:-10|g\ncanary.my_gauge_total:-10|g"
+	if got := w.String(); expected != got {
+		t.Fatalf("expected:\n[%s]\nbut got:\n[%s]", expected, got)
+	}
+}
+
+func TestNoopClient(t *testing.T) {
+	client := NewNoopClient()
+
+	if err := client.Increment("my_metric"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.GaugeDeltaFloat("my_gauge", -0.5); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.TaggedIncrement("my_metric", "env:dev"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.Flush(-1); err != nil {
+		t.Fatal(err)
+	}
+
+	if client.IsClosed() {
+		t.Fatalf("expected the noop client to be open before close")
+	}
+
+	client.Close()
+	if !client.IsClosed() {
+		t.Fatalf("expected the noop client to be closed")
+	}
+
+	if err := client.Increment("my_metric"); err != nil {
+		t.Fatalf("expected no error on the closed noop client but got %v", err)
+	}
+
+	if got := client.PacketsSent(); got != 0 {
+		t.Fatalf("expected no packets but got %d", got)
+	}
+}
+
+func TestNilClient(t *testing.T) {
+	var client *Client
+
+	ok := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("expected nil error on a nil client but got %v", err)
+		}
+	}
+
+	client.SetMaxPackageSize(100)
+	client.SetFormatter(strings.ToUpper)
+	client.ClearFormatter()
+	client.SetPrefix("my_prefix.")
+	if prefix := client.Prefix(); prefix != "" {
+		t.Fatalf("expected empty prefix but got [%s]", prefix)
+	}
+	client.RegisterGauge("my_gauge", func() int { return 1 })
+	client.OnFlush(func([]byte) {})
+	ok(client.FlushEvery(time.Second))
+
+	ok(client.WriteMetric("my_metric", "1", Count, 1))
+	ok(client.WriteMetricTyped("my_metric", "1", Count, 1))
+	ok(client.WriteMetricAt("my_metric", "1", Count, 1, time.Now()))
+	ok(client.WriteMetricMulti("my_metric", []string{"1", "2"}, Time, 1))
+	ok(client.WriteMetricTags("my_metric", "1", Count, 1, "env:dev"))
+	ok(client.WriteRaw("my_metric:1|c"))
+	_, err := client.WriteMetricFlushed("my_metric", "1", Count, 1)
+	ok(err)
+	_, err = client.CopyFrom(strings.NewReader("my_metric:1|c"))
+	ok(err)
+
+	ok(client.Count("my_metric", 1))
+	ok(client.Increment("my_metric"))
+	ok(client.Gauge("my_gauge", -1))
+	ok(client.Gauges(map[string]int{"my_gauge": 1}))
+	ok(client.GaugeRate("my_gauge", 1, 0.5))
+	ok(client.GaugeFloat64("my_gauge", 0.5))
+	ok(client.GaugeDelta("my_gauge", 1))
+	ok(client.GaugeDeltaFloat("my_gauge", -0.5))
+	ok(client.Unique("my_set", 1))
+	ok(client.Time("my_time", time.Second))
+	ok(client.TimeMicro("my_time", time.Second))
+	ok(client.Histogram("my_histogram", 1))
+	ok(client.Record("my_time", 1)())
+	ok(client.RecordFunc("my_time", 1, func() {}))
+	ok(client.RecordContext(context.Background(), "my_time", 1)())
+	ok(client.TaggedIncrement("my_metric", "env:dev"))
+	ok(client.CountTags("my_metric", 1, "env:dev"))
+	ok(client.IncrementTags("my_metric", "env:dev"))
+	ok(client.GaugeTags("my_gauge", 1, "env:dev"))
+	ok(client.TimeTags("my_time", time.Second, "env:dev"))
+
+	timer := NewTimer(client, "my_timer")
+	timer.Start()
+	ok(timer.Lap("phase"))
+	ok(timer.Stop())
+
+	ok(client.Flush(-1))
+	_, err = client.FlushIfPending()
+	ok(err)
+
+	if client.History() != nil || client.RemoteAddr() != nil {
+		t.Fatalf("expected no history and no remote address on a nil client")
+	}
+
+	if client.FlushCount() != 0 || client.PacketsSent() != 0 || client.Dropped() != 0 {
+		t.Fatalf("expected zero counters on a nil client")
+	}
+
+	if !client.IsClosed() {
+		t.Fatalf("expected a nil client to be closed")
+	}
+	ok(client.Close())
+}
+
+func TestClientCountSampled(t *testing.T) {
+	w := new(bytes.Buffer)
+	client := NewClientWriter(w, "")
+	client.CountSampled("my_metric", 10, 40)
+	client.CountSampled("my_metric", 5, 5)
+	client.Close()
+
+	if expected, got := "my_metric:10|c|@0.25\nmy_metric:5|c", w.String(); expected != got {
+		t.Fatalf("expected:\n[%s]\nbut got:\n[%s]", expected, got)
+	}
+
+	client = NewClientWriter(ioutil.Discard, "", WithStrict())
+	defer client.Close()
+
+	if err := client.CountSampled("my_metric", 10, 0); err != ErrInvalidRate {
+		t.Fatalf("expected ErrInvalidRate but got %v", err)
+	}
+}
+
+func TestClientFlushPacketBoundaries(t *testing.T) {
+	var packets []string
+	w := &failingWriter{ClosingBuffer: ClosingBuffer{new(bytes.Buffer)}, fail: true}
+	client := NewClient(w, "")
+	client.OnFlush(func(payload []byte) { packets = append(packets, string(payload)) })
+	client.SetMaxPackageSize(len("my_metric:1|c\nmy_metric:2|c"))
+
+	// the buffer grows to several packets while the writes fail.
+	for i := 0; i < 5; i++ {
+		client.Count("my_metric", i)
+	}
+
+	w.fail = false
+	if err := client.Flush(-1); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "my_metric:0|c\nmy_metric:1|c my_metric:2|c\nmy_metric:3|c my_metric:4|c"
+	if got := strings.Join(packets, " "); expected != got {
+		t.Fatalf("expected the packets [%s] but got [%s]", expected, got)
+	}
+
+	if expected, got := uint64(3), client.PacketsSent(); expected != got {
+		t.Fatalf("expected %d packets but got %d", expected, got)
+	}
+	client.Close()
+}
+
+func TestDialer(t *testing.T) {
+	server, conn := net.Pipe()
+	defer server.Close()
+
+	var network, addr string
+	dial := func(n, a string) (net.Conn, error) {
+		network, addr = n, a
+		return conn, nil
+	}
+
+	for _, tt := range []struct {
+		dial            func(string, Dialer) (io.WriteCloser, error)
+		expectedNetwork string
+	}{
+		{UDPWithDialer, "udp"},
+		{TCPWithDialer, "tcp"},
+	} {
+		w, err := tt.dial("", dial)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if w != conn || network != tt.expectedNetwork || addr != ":8125" {
+			t.Fatalf("expected the dialer to be called with %s :8125 but got %s %s", tt.expectedNetwork, network, addr)
+		}
+	}
+
+	client := NewClient(conn, "", WithFraming(FramingStream))
+	received := make(chan string, 1)
+	go func() {
+		b, _ := ioutil.ReadAll(server)
+		received <- string(b)
+	}()
+
+	client.Increment("my_metric")
+	client.Close()
+
+	if expected, got := "my_metric:1|c\n", <-received; expected != got {
+		t.Fatalf("expected [%s] but got [%s]", expected, got)
+	}
+}
+
+func TestTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer l.Close()
+
+	conn, err := TCP(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+}
+
+func TestClientRecordUntil(t *testing.T) {
+	clock := newFakeClock()
+	client := NewClientWriter(ioutil.Discard, "", WithClock(clock), WithFlushEveryN(1))
+
+	packets := make(chan string, 1)
+	client.OnFlush(func(payload []byte) { packets <- string(payload) })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	client.RecordUntil(ctx, "my_metric", 1)
+	clock.Advance(time.Second)
+	cancel()
+
+	select {
+	case got := <-packets:
+		if expected := "my_metric:1000|ms"; expected != got {
+			t.Fatalf("expected [%s] but got [%s]", expected, got)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected the metric to be written on the context's cancellation")
+	}
+
+	before := runtime.NumGoroutine()
+	client.RecordUntil(context.Background(), "my_metric2", 1)
+	client.Close()
+
+	n := runtime.NumGoroutine()
+	for i := 0; i < 100 && n > before; i++ {
+		time.Sleep(time.Millisecond)
+		n = runtime.NumGoroutine()
+	}
+
+	if n > before {
+		t.Fatalf("expected the watcher goroutine to exit on close")
+	}
+}
+
+func TestClientNewline(t *testing.T) {
+	w := new(bytes.Buffer)
+	client := NewClientWriter(w, "")
+	client.SetFormatter(func(metricName string) string { return metricName + "\nevil:1|c" })
+	client.Increment("my_metric")
+	client.WriteMetric("my_metric2", "1\n", Gauge, 1)
+	client.Close()
+
+	if expected, got := "my_metric_evil:1|c:1|c\nmy_metric2_evil:1|c:1_|g", w.String(); expected != got {
+		t.Fatalf("expected:\n[%s]\nbut got:\n[%s]", expected, got)
+	}
+
+	client = NewClientWriter(ioutil.Discard, "", WithStrict())
+	defer client.Close()
+
+	if err := client.Increment("my_metric\n"); err != ErrNewline {
+		t.Fatalf("expected ErrNewline but got %v", err)
+	}
+}
+
+func TestClientPrefixNewline(t *testing.T) {
+	w := new(bytes.Buffer)
+	client := NewClientWriter(w, "", WithFraming(FramingStream))
+	client.WriteMetricPrefix("evil:1|c\n", "my_metric", "1", Count, 1)
+	client.SetPrefix("evil:1|c\n")
+	client.Increment("my_metric")
+	client.Close()
+
+	if expected, got := "evil:1|c_my_metric:1|c\nevil:1|c_my_metric:1|c\n", w.String(); expected != got {
+		t.Fatalf("expected:\n[%s]\nbut got:\n[%s]", expected, got)
+	}
+
+	var errs []error
+	client = NewClientWriter(ioutil.Discard, "my_prefix.", WithStrict())
+	client.OnError(func(err error) { errs = append(errs, err) })
+	defer client.Close()
+
+	if err := client.WriteMetricPrefix("evil:1|c\n", "my_metric", "1", Count, 1); err != ErrNewline {
+		t.Fatalf("expected ErrNewline but got %v", err)
+	}
+
+	client.SetPrefix("evil:1|c\n")
+	if len(errs) != 1 || errs[0] != ErrNewline {
+		t.Fatalf("expected ErrNewline to be reported but got %v", errs)
+	}
+
+	if expected, got := "my_prefix.", client.Prefix(); expected != got {
+		t.Fatalf("expected the prefix to be kept [%s] but got [%s]", expected, got)
+	}
+}
+
+func TestClientNilWriter(t *testing.T) {
+	for _, client := range []*Client{NewClient(nil, ""), NewClientWriter(nil, "")} {
+		if err := client.Increment("my_metric"); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := client.Flush(-1); err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, got := uint64(1), client.PacketsSent(); expected != got {
+			t.Fatalf("expected %d discarded packet but got %d", expected, got)
+		}
+
+		if err := client.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestClientFlushWatchdog(t *testing.T) {
+	clock := newFakeClock()
+	client := NewClientWriter(ioutil.Discard, "", WithClock(clock), WithFlushWatchdog(time.Second))
+	defer client.Close()
+
+	errs := make(chan error, 1)
+	client.OnError(func(err error) { errs <- err })
+
+	expectNoError := func() {
+		t.Helper()
+		select {
+		case err := <-errs:
+			t.Fatalf("expected no error but got %v", err)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	// empty buffer.
+	clock.Advance(time.Second)
+	expectNoError()
+
+	client.Increment("my_metric")
+	clock.Advance(time.Second)
+
+	select {
+	case err := <-errs:
+		if err != ErrNotFlushed {
+			t.Fatalf("expected ErrNotFlushed but got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected the watchdog to report the not flushed metrics")
+	}
+
+	client.Flush(-1)
+	clock.Advance(time.Second)
+	expectNoError()
+}
+
+func TestClientFlushEveryOnError(t *testing.T) {
+	clock := newFakeClock()
+	w := &failingWriter{ClosingBuffer: ClosingBuffer{new(bytes.Buffer)}, fail: true}
+	client := NewClient(w, "", WithClock(clock))
+
+	errs := make(chan error, 1)
+	client.OnError(func(err error) { errs <- err })
+
+	client.Increment("my_metric")
+	client.FlushEvery(time.Second)
+	clock.Advance(time.Second)
+
+	select {
+	case err := <-errs:
+		if err != errWrite {
+			t.Fatalf("expected the write error but got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected the flush error to be reported")
+	}
+
+	client.OnError(nil)
+	client.Close()
+}
+
+func TestClientFlushEveryStop(t *testing.T) {
+	clock := newFakeClock()
+	client := NewClientWriter(ioutil.Discard, "", WithClock(clock))
+	defer client.Close()
+
+	packets := make(chan string, 1)
+	client.OnFlush(func(payload []byte) { packets <- string(payload) })
+
+	stop, err := client.FlushEveryStop(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client.Increment("my_metric")
+	clock.Advance(time.Second)
+
+	select {
+	case got := <-packets:
+		if expected := "my_metric:1|c"; expected != got {
+			t.Fatalf("expected [%s] but got [%s]", expected, got)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected a flush")
+	}
+
+	stop()
+	stop() // no-op.
+
+	client.Increment("my_metric2")
+	clock.Advance(time.Second)
+
+	select {
+	case got := <-packets:
+		t.Fatalf("expected no flush after stop but got [%s]", got)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	client.Flush(-1)
+	if expected, got := "my_metric2:1|c", <-packets; expected != got {
+		t.Fatalf("expected the manual flush of [%s] but got [%s]", expected, got)
+	}
+}
+
+func TestClientWriteTimeout(t *testing.T) {
+	server, conn := net.Pipe() // writes block until the other side reads.
+	defer server.Close()
+
+	client := NewClient(conn, "", WithWriteTimeout(50*time.Millisecond))
+	client.Increment("my_metric")
+
+	err := client.Flush(-1)
+	if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+		t.Fatalf("expected a timeout error but got %v", err)
+	}
+
+	if expected, got := "my_metric:1|c\n", string(client.buf); expected != got {
+		t.Fatalf("expected the metrics to be kept in the buffer but got [%s]", got)
+	}
+
+	received := make(chan string, 1)
+	go func() {
+		b := make([]byte, 64)
+		n, _ := server.Read(b)
+		received <- string(b[:n])
+	}()
+
+	if err = client.Flush(-1); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := "my_metric:1|c", <-received; expected != got {
+		t.Fatalf("expected [%s] but got [%s]", expected, got)
+	}
+	client.Close()
+}
+
+type slowWriter struct {
+	clock *fakeClock
+	fail  bool
+}
+
+func (w *slowWriter) Write(b []byte) (int, error) {
+	w.clock.Advance(time.Millisecond)
+	if w.fail {
+		return 0, errWrite
+	}
+
+	return len(b), nil
+}
+
+func TestClientOnFlushStats(t *testing.T) {
+	clock := newFakeClock()
+	w := &slowWriter{clock: clock}
+	client := NewClientWriter(w, "", WithClock(clock))
+	client.SetMaxPackageSize(len("my_metric:1|c\nmy_metric:1|c"))
+
+	var stats []FlushStats
+	client.OnFlushStats(func(s FlushStats) { stats = append(stats, s) })
+
+	client.Flush(-1) // empty, no stats.
+	for i := 0; i < 3; i++ {
+		client.Increment("my_metric")
+	}
+	client.Flush(-1)
+
+	w.fail = true
+	client.Increment("my_metric")
+	client.Flush(-1)
+
+	expected := []FlushStats{
+		{Metrics: 2, Packets: 1, Bytes: 27, Duration: time.Millisecond},
+		{Metrics: 1, Packets: 1, Bytes: 13, Duration: time.Millisecond},
+		{Duration: time.Millisecond, Err: errWrite},
+	}
+
+	if len(stats) != len(expected) {
+		t.Fatalf("expected %d flush stats but got %d: %+v", len(expected), len(stats), stats)
+	}
+
+	for i := range expected {
+		if expected[i] != stats[i] {
+			t.Fatalf("[%d] expected %+v but got %+v", i, expected[i], stats[i])
+		}
+	}
+
+	client.OnFlushStats(nil)
+	client.Close()
+}
+
+func TestClientDelimiters(t *testing.T) {
+	w := new(bytes.Buffer)
+	client := NewClientWriter(w, "", WithDelimiters('=', ';', '~'), WithGlobalTags("env:dev"))
+	client.WriteMetric("my_metric", "1", Count, 0.5)
+	client.Close()
+
+	if expected, got := "my_metric=1;c;~0.5;#env:dev", w.String(); expected != got {
+		t.Fatalf("expected [%s] but got [%s]", expected, got)
+	}
+}
+
+func TestClientDuplicateDetection(t *testing.T) {
+	client := NewClientWriter(ioutil.Discard, "my_prefix.", WithDuplicateDetection())
+	defer client.Close()
+
+	var errs []error
+	client.OnError(func(err error) { errs = append(errs, err) })
+
+	client.Gauge("my_gauge", 1)
+	client.Increment("my_metric")
+	client.Increment("my_metric") // counters are not tracked by default.
+	client.Gauge("my_gauge", -2)
+	client.Flush(-1)
+	client.Gauge("my_gauge", 3) // a new flush window.
+
+	if len(errs) != 1 {
+		t.Fatalf("expected a single duplicate but got %v", errs)
+	}
+
+	dup, ok := errs[0].(*DuplicateMetricError)
+	if !ok || dup.Name != "my_gauge" || dup.Type != Gauge {
+		t.Fatalf("expected the duplicate my_gauge gauge but got %v", errs[0])
+	}
+}
+
+func TestClientFormat(t *testing.T) {
+	w := new(bytes.Buffer)
+	client := NewClientWriter(w, "my_prefix.", WithGlobalTags("env:dev"))
+	client.SetFormatter(strings.ToUpper)
+
+	tests := []struct {
+		value    string
+		typ      string
+		rate     float32
+		expected string
+	}{
+		{"1", Count, 0.5, "my_prefix.MY_METRIC:1|c|@0.5|#env:dev"},
+		{"-10", Gauge, 1, "my_prefix.MY_METRIC:0|g|#env:dev\nmy_prefix.MY_METRIC:-10|g|#env:dev"},
+	}
+
+	for i, tt := range tests {
+		got := client.Format("my_metric", tt.value, tt.typ, tt.rate)
+		if tt.expected != got {
+			t.Fatalf("[%d] expected:\n[%s]\nbut got:\n[%s]", i, tt.expected, got)
+		}
+
+		client.WriteMetric("my_metric", tt.value, tt.typ, tt.rate)
+		client.Flush(-1)
+		if got = w.String(); tt.expected != got {
+			t.Fatalf("[%d] expected the written line to match the format:\n[%s]\nbut got:\n[%s]", i, tt.expected, got)
+		}
+		w.Reset()
+	}
+
+	client.SetFormatter(func(string) string { return "" })
+	if got := client.Format("my_metric", "1", Count, 1); got != "" {
+		t.Fatalf("expected an empty line for an ignored metric but got [%s]", got)
+	}
+	client.Close()
+}
+
+func TestClientFormatAggregated(t *testing.T) {
+	client := NewClientWriter(ioutil.Discard, "", WithTimerAggregation())
+	defer client.Close()
+
+	if got := client.Format("my_timer", "10", Time, 1); got != "" {
+		t.Fatalf("expected an empty line for an aggregated metric but got [%s]", got)
+	}
+
+	if expected, got := "my_metric:1|c", client.Format("my_metric", "1", Count, 1); expected != got {
+		t.Fatalf("expected [%s] but got [%s]", expected, got)
+	}
+}
+
+func TestClientWriteMetricRawName(t *testing.T) {
+	w := new(bytes.Buffer)
+	client := NewClientWriter(w, "my_prefix.", WithFraming(FramingStream))
+	client.SetFormatter(strings.ToUpper)
+
+	client.Increment("my_metric")
+	client.WriteMetricRawName("Already.Formatted", "1", Count, 1)
+	client.Increment("my_metric2")
+	client.Close()
+
+	expected := "my_prefix.MY_METRIC:1|c\nmy_prefix.Already.Formatted:1|c\nmy_prefix.MY_METRIC2:1|c\n"
+	if got := w.String(); expected != got {
+		t.Fatalf("expected:\n[%s]\nbut got:\n[%s]", expected, got)
+	}
+}
+
+func TestClientWriteMetricPrefix(t *testing.T) {
+	w := new(bytes.Buffer)
+	client := NewClientWriter(w, "my_prefix.", WithFraming(FramingStream))
+
+	client.Increment("my_metric")
+	client.WriteMetricPrefix("shared.", "my_metric", "1", Count, 1)
+	client.Increment("my_metric2")
+	client.Close()
+
+	expected := "my_prefix.my_metric:1|c\nshared.my_metric:1|c\nmy_prefix.my_metric2:1|c\n"
+	if got := w.String(); expected != got {
+		t.Fatalf("expected:\n[%s]\nbut got:\n[%s]", expected, got)
+	}
+
+	if expected, got := "my_prefix.", client.Prefix(); expected != got {
+		t.Fatalf("expected the default prefix [%s] but got [%s]", expected, got)
+	}
+}
+
+// temporaryError is a transient write error, like the "ENOBUFS" of a full UDP send buffer.
+type temporaryError struct{}
+
+func (temporaryError) Error() string   { return "temporary" }
+func (temporaryError) Temporary() bool { return true }
+
+// temporaryWriter fails with a temporary error, wrapped like the `net.Conn` errors, while "fail" is set.
+type temporaryWriter struct {
+	ClosingBuffer
+	fail bool
+}
+
+func (w *temporaryWriter) Write(b []byte) (int, error) {
+	if w.fail {
+		return 0, &net.OpError{Op: "write", Net: "udp", Err: temporaryError{}}
+	}
+
+	return w.ClosingBuffer.Write(b)
+}
+
+func TestClientTemporaryErrors(t *testing.T) {
+	w := &temporaryWriter{ClosingBuffer: ClosingBuffer{new(bytes.Buffer)}, fail: true}
+	client := NewClient(w, "")
+	defer client.Close()
+
+	client.Increment("my_metric")
+	if err := client.Flush(-1); err != nil {
+		t.Fatalf("expected the temporary error to be deferred but got %v", err)
+	}
+
+	if expected, got := uint64(1), client.Deferred(); expected != got {
+		t.Fatalf("expected %d deferred flush but got %d", expected, got)
+	}
+
+	// the metrics are kept for the next flush.
+	w.fail = false
+	if err := client.Flush(-1); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := "my_metric:1|c", w.String(); expected != got {
+		t.Fatalf("expected [%s] but got [%s]", expected, got)
+	}
+
+	for err, expected := range map[error]bool{
+		temporaryError{}:            true,
+		&net.OpError{Err: errWrite}: false,
+		errWrite:                    false,
+	} {
+		if got := isTemporary(err); expected != got {
+			t.Fatalf("expected isTemporary(%v) to be %v", err, expected)
+		}
+	}
+}
+
+func TestMustUDP(t *testing.T) {
+	conn := MustUDP("127.0.0.1:8125")
+	conn.Close()
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatal("expected MustTCP to panic for an invalid address")
+		}
+	}()
+
+	MustTCP("invalid:address:8125")
+}
+
+func TestClientUniqueString(t *testing.T) {
+	w := new(bytes.Buffer)
+	client := NewClientWriter(w, "", WithFraming(FramingStream))
+	client.UniqueString("users", "user-1")
+	client.Close()
+
+	if expected, got := "users:user-1|s\n", w.String(); expected != got {
+		t.Fatalf("expected [%s] but got [%s]", expected, got)
+	}
+
+	w = new(bytes.Buffer)
+	client = NewClientWriter(w, "", WithFraming(FramingStream), WithSetHashing(nil))
+	client.UniqueString("ips", "192.168.1.1")
+	client.UniqueString("ips", "192.168.1.1")
+	client.UniqueString("ips", "10.0.0.1")
+	client.Close()
+
+	lines := strings.Split(strings.TrimSuffix(w.String(), "\n"), "\n")
+	if len(lines) != 3 || lines[0] != lines[1] || lines[0] == lines[2] {
+		t.Fatalf("expected the same tokens for the same values only but got %v", lines)
+	}
+
+	if expected, got := len("ips:|s")+16, len(lines[0]); expected != got {
+		t.Fatalf("expected a 16 characters token but got [%s]", lines[0])
+	}
+
+	w = new(bytes.Buffer)
+	client = NewClientWriter(w, "", WithSetHashing(strings.ToUpper))
+	client.UniqueString("users", "user-1")
+	client.Close()
+
+	if expected, got := "users:USER-1|s", w.String(); expected != got {
+		t.Fatalf("expected [%s] but got [%s]", expected, got)
+	}
+}
+
+func TestClientGaugeOperations(t *testing.T) {
+	tests := []struct {
+		write    func(c *Client) error
+		expected string
+	}{
+		{func(c *Client) error { return c.GaugeSet("my_gauge", 10) }, "my_gauge:10|g"},
+		{func(c *Client) error { return c.Gauge("my_gauge", 10) }, "my_gauge:10|g"},
+		{func(c *Client) error { return c.GaugeSet("my_gauge", -10) }, "my_gauge:0|g\nmy_gauge:-10|g"},
+		{func(c *Client) error { return c.GaugeDelta("my_gauge", 2) }, "my_gauge:+2|g"},
+		{func(c *Client) error { return c.GaugeDelta("my_gauge", -2) }, "my_gauge:-2|g"},
+	}
+
+	for i, tt := range tests {
+		w := new(bytes.Buffer)
+		client := NewClientWriter(w, "")
+		if err := tt.write(client); err != nil {
+			t.Fatalf("[%d] %v", i, err)
+		}
+		client.Close()
+
+		if got := w.String(); tt.expected != got {
+			t.Fatalf("[%d] expected:\n[%s]\nbut got:\n[%s]", i, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package statsd
+
+import (
+	"bytes"
+	"sync/atomic"
+)
+
+// flushSwapped flushes the whole buffer like the `flush(-1)` but the buffer is swapped with a spare one
+// and it is written outside of the lock, so the producers are not blocked by the writer, see `WithSwapFlush`.
+// It should be called with the lock and the "swapMu" held, the lock is released during the writes
+// and it is held again when it returns.
+func (c *Client) flushSwapped() error {
+	if c.limiter != nil {
+		return c.flush(-1) // the rate limited packets are kept in the buffer.
+	}
+
+	c.beginFlush(-1)
+	if len(c.buf) == 0 {
+		return nil
+	}
+
+	// the swapped buffer is owned by the flusher until the lock is held again.
+	out := c.buf
+	c.buf, c.spare = c.spare[:0], nil
+	if c.flushEveryN > 0 {
+		c.pending = 0
+	}
+
+	var (
+		limit   = c.packetLimit()
+		copies  = c.onFlush != nil
+		stats   *FlushStats
+		flushed []*[]byte
+	)
+	if c.onFlushStats != nil {
+		stats = &FlushStats{}
+	}
+	start := c.clock.Now()
+	c.mu.Unlock() // the callbacks are dispatched by the caller.
+
+	sent, err := 0, error(nil)
+	for sent < len(out) {
+		end := sent + packetEndOf(out[sent:], len(out)-sent, limit)
+		payload, written, werr := c.writePacket(out[sent:end], &c.swapEncoded)
+		if werr != nil {
+			sent += written // the written head of a stream is not retried.
+			err = werr
+			break
+		}
+
+		if stats != nil {
+			stats.Packets++
+			stats.Bytes += len(payload)
+			stats.Metrics += bytes.Count(out[sent:end], newLine)
+		}
+
+		if copies {
+			p := getBuffer()
+			*p = append(*p, payload...)
+			flushed = append(flushed, p)
+		}
+
+		sent = end
+		atomic.AddUint64(&c.packets, 1)
+	}
+
+	if err == nil {
+		err = c.flushWriter() // once, after the last packet.
+	}
+
+	if err == nil {
+		atomic.AddUint64(&c.flushes, 1)
+	} else {
+		err = c.deferTemporary(err)
+	}
+
+	c.mu.Lock()
+	if sent < len(out) {
+		// the rest is retried first, before the metrics written during the flush.
+		rest := out[sent:]
+		c.buf = append(append(make([]byte, 0, len(rest)+len(c.buf)), rest...), c.buf...)
+		if c.flushEveryN > 0 {
+			c.pending = bytes.Count(c.buf, newLine)
+		}
+		c.dropOverflow()
+	} else {
+		c.spare = out[:0]
+	}
+
+	c.flushed = append(c.flushed, flushed...)
+	if stats != nil && (stats.Packets > 0 || err != nil) {
+		stats.Duration = c.clock.Now().Sub(start)
+		stats.Err = err
+		c.flushStats = append(c.flushStats, *stats)
+	}
+
+	return err
+}
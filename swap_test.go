@@ -0,0 +1,147 @@
+package statsd
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingWriter blocks each write until it receives from "release", "entered" receives on each write.
+type blockingWriter struct {
+	entered chan struct{}
+	release chan struct{}
+
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (w *blockingWriter) Write(b []byte) (int, error) {
+	w.entered <- struct{}{}
+	<-w.release
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Write(b)
+}
+
+func (w *blockingWriter) Close() error { return nil }
+
+func (w *blockingWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.String()
+}
+
+func TestClientSwapFlush(t *testing.T) {
+	w := &blockingWriter{entered: make(chan struct{}), release: make(chan struct{})}
+	client := NewClient(w, "", WithSwapFlush(), WithFraming(FramingStream))
+
+	client.Increment("a")
+	flushed := make(chan error)
+	go func() { flushed <- client.Flush(-1) }()
+	<-w.entered
+
+	// the producers are not blocked by the write in progress.
+	written := make(chan error)
+	go func() { written <- client.Increment("b") }()
+	select {
+	case err := <-written:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the write not to be blocked by the flush")
+	}
+
+	w.release <- struct{}{}
+	if err := <-flushed; err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := "a:1|c\n", w.String(); expected != got {
+		t.Fatalf("expected [%s] but got [%s]", expected, got)
+	}
+
+	go func() {
+		<-w.entered
+		w.release <- struct{}{}
+	}()
+	client.Flush(-1)
+
+	if expected, got := "a:1|c\nb:1|c\n", w.String(); expected != got {
+		t.Fatalf("expected [%s] but got [%s]", expected, got)
+	}
+
+	client.Close() // nothing left to write.
+}
+
+func TestClientSwapFlushRetry(t *testing.T) {
+	w := &failingWriter{ClosingBuffer: ClosingBuffer{new(bytes.Buffer)}, fail: true}
+	client := NewClient(w, "", WithSwapFlush(), WithFraming(FramingStream))
+	defer client.Close()
+
+	client.Increment("a")
+	if err := client.Flush(-1); err != errWrite {
+		t.Fatalf("expected the write error but got %v", err)
+	}
+
+	// the failed metrics are retried before the new ones.
+	client.Increment("b")
+	w.fail = false
+	if err := client.Flush(-1); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := "a:1|c\nb:1|c\n", w.String(); expected != got {
+		t.Fatalf("expected [%s] but got [%s]", expected, got)
+	}
+}
+
+// slowConn is a writer which takes some time per write, like a congested network connection.
+type slowConn struct{}
+
+func (slowConn) Write(b []byte) (int, error) {
+	time.Sleep(50 * time.Microsecond)
+	return len(b), nil
+}
+
+func (slowConn) Close() error { return nil }
+
+// BenchmarkClientSwapFlush measures the latency of the producers while the buffer is flushed continuously to a slow writer.
+func BenchmarkClientSwapFlush(b *testing.B) {
+	for _, bb := range []struct {
+		name string
+		opts []Option
+	}{
+		{"locked", nil},
+		{"swapped", []Option{WithSwapFlush()}},
+	} {
+		b.Run(bb.name, func(b *testing.B) {
+			client := NewClient(slowConn{}, "", bb.opts...)
+			client.SetMaxPackageSize(1 << 16) // only the flusher writes.
+
+			done := make(chan struct{})
+			go func() {
+				for {
+					select {
+					case <-done:
+						return
+					default:
+						client.Flush(-1)
+					}
+				}
+			}()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				client.Increment("my_metric")
+			}
+			b.StopTimer()
+
+			close(done)
+			client.Close()
+		})
+	}
+}
@@ -0,0 +1,247 @@
+package statsd
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TagStyle is the format of the metric tags, tags are an extension of the statsd protocol
+// and each server supports its own format, see `WithTagStyle`.
+type TagStyle uint8
+
+const (
+	// TagStyleDatadog writes the tags after the metric type and the sample rate,
+	// i.e "my_metric:1|c|#key:value,key2:value2".
+	// Read more at: https://docs.datadoghq.com/developers/dogstatsd/datagram_shell/
+	TagStyleDatadog TagStyle = iota
+	// TagStyleGraphite writes the tags as part of the metric name,
+	// i.e "my_metric;key=value;key2=value2:1|c".
+	// Read more at: https://graphite.readthedocs.io/en/latest/tags.html
+	TagStyleGraphite
+	// TagStyleSignalFx writes the tags as dimensions between brackets after the metric name,
+	// i.e "my_metric[key=value,key2=value2]:1|c".
+	// Read more at: https://docs.signalfx.com/en/latest/integrations/agent/monitors/collectd-statsd.html
+	TagStyleSignalFx
+	// TagStyleLibrato writes the tags, i.e the "source", after a '#' following the metric name,
+	// i.e "my_metric#source=host1,key=value:1|c".
+	// Read more at: https://github.com/librato/statsd-librato-backend#tags
+	TagStyleLibrato
+)
+
+// appendNameTags appends the "tags" which are part of the metric name.
+func appendNameTags(dst []byte, style TagStyle, tags []string) []byte {
+	switch style {
+	case TagStyleGraphite:
+		for _, tag := range tags {
+			dst = append(dst, ';')
+			dst = appendTag(dst, tag, '=')
+		}
+	case TagStyleSignalFx:
+		if len(tags) == 0 {
+			return dst
+		}
+
+		dst = append(dst, '[')
+		dst = appendTagList(dst, tags)
+		dst = append(dst, ']')
+	case TagStyleLibrato:
+		if len(tags) == 0 {
+			return dst
+		}
+
+		dst = append(dst, '#')
+		dst = appendTagList(dst, tags)
+	}
+
+	return dst
+}
+
+// appendSuffixTags appends the "tags" which are written at the end of the metric line, after the "sep".
+func appendSuffixTags(dst []byte, style TagStyle, sep byte, tags []string) []byte {
+	if style != TagStyleDatadog || len(tags) == 0 {
+		return dst
+	}
+
+	dst = append(dst, sep, '#')
+	for i, tag := range tags {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		dst = append(dst, tag...)
+	}
+
+	return dst
+}
+
+// appendTagList appends the "tags" as comma separated "key=value" pairs.
+func appendTagList(dst []byte, tags []string) []byte {
+	for i, tag := range tags {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		dst = appendTag(dst, tag, '=')
+	}
+
+	return dst
+}
+
+// appendTag appends a "key:value" tag, its key, value separator is replaced with "sep".
+func appendTag(dst []byte, tag string, sep byte) []byte {
+	for i := 0; i < len(tag); i++ {
+		if tag[i] == ':' {
+			dst = append(dst, tag[:i]...)
+			dst = append(dst, sep)
+			return append(dst, tag[i+1:]...)
+		}
+	}
+
+	return append(dst, tag...)
+}
+
+// withGlobalTags returns the global tags (see `WithGlobalTags`) followed by the "tags".
+func (c *Client) withGlobalTags(tags []string) []string {
+	global := c.tags
+	if c.dynamicTags != nil {
+		if !c.dynamicFresh {
+			c.dynamic = append(c.tags[:len(c.tags):len(c.tags)], c.dynamicTags()...)
+			c.dynamicFresh = true
+		}
+		global = c.dynamic
+	}
+
+	if len(global) == 0 {
+		return tags
+	}
+
+	if len(tags) == 0 {
+		return global
+	}
+
+	all := make([]string, 0, len(global)+len(tags))
+	all = append(all, global...)
+	return append(all, tags...)
+}
+
+// sanitizeTags replaces the new lines of the "tags", the per-call, global and dynamic ones, with underscores,
+// like the ones of the metric names, or it returns `ErrNewline` on `WithStrict` mode.
+// The "tags" are shared, a copy is returned if any of them is changed.
+func (c *Client) sanitizeTags(tags []string) ([]string, error) {
+	for i, tag := range tags {
+		if strings.IndexByte(tag, '\n') < 0 {
+			continue
+		}
+
+		if c.strict {
+			return nil, ErrNewline
+		}
+
+		sanitized := append(make([]string, 0, len(tags)), tags[:i]...)
+		for _, tag := range tags[i:] {
+			sanitized = append(sanitized, strings.Replace(tag, "\n", "_", -1))
+		}
+		return sanitized, nil
+	}
+
+	return tags, nil
+}
+
+// WriteMetricTags same as `WriteMetric` but it writes the metric with the given "tags".
+// Each tag should be in the form of "key:value", the tags are written based on the `WithTagStyle`.
+//
+// Note that tags are not supported by all statsd servers.
+func (c *Client) WriteMetricTags(metricName, value, typ string, rate float32, tags ...string) error {
+	if c.disabled() {
+		return nil
+	}
+
+	if c.IsClosed() {
+		return ErrClosed
+	}
+
+	c.mu.Lock()
+	err := c.writeMetric(metricName, value, typ, rate, tags, 0)
+	c.unlock()
+
+	return err
+}
+
+// TaggedIncrement is a shortcut of `Client#WriteMetricTags(metricName, "1", statsd.Count, 1, tags...)`,
+// the rate can be customized through the `WithDefaultRate`.
+func (c *Client) TaggedIncrement(metricName string, tags ...string) error {
+	return c.writeDefault(metricName, "1", Count, tags)
+}
+
+// CountTags same as `Client#Count` but it writes the metric with the given "tags".
+func (c *Client) CountTags(metricName string, value int, tags ...string) error {
+	return c.writeDefault(metricName, Int(value), Count, tags)
+}
+
+// IncrementTags is a shortcut of `Client#CountTags(metricName, 1, tags...)`.
+func (c *Client) IncrementTags(metricName string, tags ...string) error {
+	return c.CountTags(metricName, 1, tags...)
+}
+
+// GaugeTags same as `Client#Gauge` but it writes the metric with the given "tags".
+func (c *Client) GaugeTags(metricName string, value int, tags ...string) error {
+	return c.writeDefault(metricName, Int(value), Gauge, tags)
+}
+
+// TimeTags same as `Client#Time` but it writes the metric with the given "tags".
+func (c *Client) TimeTags(metricName string, value time.Duration, tags ...string) error {
+	return c.writeDefault(metricName, Duration(value), Time, tags)
+}
+
+// GaugeWithUnit same as `Client#Gauge` but it writes the "unit" of the value as a "unit:<unit>" tag,
+// i.e "unit:ms" or "unit:bytes", tag-aware backends can use it to label the dashboards' axes.
+// The value itself is written as it is. An empty "unit" writes no tag.
+//
+// Note that units are not part of the statsd protocol, the tag is ignored or rejected by servers without tags support.
+func (c *Client) GaugeWithUnit(metricName string, value int, unit string) error {
+	if unit == "" {
+		return c.GaugeTags(metricName, value)
+	}
+
+	return c.GaugeTags(metricName, value, "unit:"+unit)
+}
+
+// TimeWithPercentiles same as `Client#Time` but it writes a companion "<metricName>.percentiles" gauge line
+// which carries the requested percentiles as a tag, i.e "my_timer.percentiles:1|g|#percentiles:50_90_99",
+// for collectors which configure the timers' percentiles from the metrics they receive.
+//
+// Note that no statsd server understands the companion line out of the box,
+// it is a hint for custom collectors and it is a plain gauge for the rest, the timing itself is not affected.
+func (c *Client) TimeWithPercentiles(metricName string, value time.Duration, pcts ...int) error {
+	if len(pcts) == 0 {
+		return c.Time(metricName, value)
+	}
+
+	if c.disabled() {
+		return nil
+	}
+
+	if c.IsClosed() {
+		return ErrClosed
+	}
+
+	hint := make([]byte, 0, len("percentiles:")+3*len(pcts))
+	hint = append(hint, "percentiles:"...)
+	for i, p := range pcts {
+		if i > 0 {
+			hint = append(hint, '_')
+		}
+		hint = strconv.AppendInt(hint, int64(p), 10)
+	}
+
+	var err error
+	c.mu.Lock()
+	if rate, ok := c.sampleDefault(Time); ok {
+		err = c.writeMetric(metricName, Duration(value), Time, rate, nil, 0)
+	}
+	if err == nil {
+		err = c.writeMetric(metricName+".percentiles", "1", Gauge, 1, []string{string(hint)}, 0)
+	}
+	c.unlock()
+
+	return err
+}
@@ -0,0 +1,196 @@
+package statsd
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestClientWriteMetricTags(t *testing.T) {
+	tests := []struct {
+		style    TagStyle
+		expected string
+	}{
+		{TagStyleDatadog, "my_prefix.my_metric:1|c|#method:GET,status:200\nmy_prefix.my_metric2:0.5|g|@0.1|#env:dev"},
+		{TagStyleGraphite, "my_prefix.my_metric;method=GET;status=200:1|c\nmy_prefix.my_metric2;env=dev:0.5|g|@0.1"},
+		{TagStyleSignalFx, "my_prefix.my_metric[method=GET,status=200]:1|c\nmy_prefix.my_metric2[env=dev]:0.5|g|@0.1"},
+		{TagStyleLibrato, "my_prefix.my_metric#method=GET,status=200:1|c\nmy_prefix.my_metric2#env=dev:0.5|g|@0.1"},
+	}
+
+	for i, tt := range tests {
+		w := &ClosingBuffer{new(bytes.Buffer)}
+		client := NewClient(w, "my_prefix.", WithTagStyle(tt.style))
+
+		if err := client.TaggedIncrement("my_metric", "method:GET", "status:200"); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := client.WriteMetricTags("my_metric2", Float64(0.5), Gauge, 0.1, "env:dev"); err != nil {
+			t.Fatal(err)
+		}
+
+		client.Flush(-1)
+
+		if got := w.String(); tt.expected != got {
+			t.Fatalf("[%d] expected:\n[%s]\nbut got:\n[%s]", i, tt.expected, got)
+		}
+
+		client.Close()
+	}
+}
+
+func TestClientGlobalTags(t *testing.T) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Skip(err)
+	}
+
+	w := new(bytes.Buffer)
+	client := NewClientWriter(w, "", WithGlobalTags("env:dev"), WithHostTag())
+	client.Gauge("my_gauge", -1)
+	client.TaggedIncrement("my_metric", "status:200")
+	client.Close()
+
+	expected := "my_gauge:0|g|#env:dev,host:" + hostname +
+		"\nmy_gauge:-1|g|#env:dev,host:" + hostname +
+		"\nmy_metric:1|c|#env:dev,host:" + hostname + ",status:200"
+	if got := w.String(); expected != got {
+		t.Fatalf("expected:\n[%s]\nbut got:\n[%s]", expected, got)
+	}
+}
+
+func TestClientDynamicTags(t *testing.T) {
+	w := new(bytes.Buffer)
+	version, calls := "1", 0
+	client := NewClientWriter(w, "", WithGlobalTags("env:dev"), WithDynamicTags(func() []string {
+		calls++
+		return []string{"version:" + version}
+	}))
+	defer client.Close()
+
+	client.Increment("my_metric")
+	version = "2" // the tags are evaluated once per flush window.
+	client.TaggedIncrement("my_metric", "status:200")
+	client.Flush(-1)
+
+	expected := "my_metric:1|c|#env:dev,version:1\nmy_metric:1|c|#env:dev,version:1,status:200"
+	if got := w.String(); expected != got {
+		t.Fatalf("expected:\n[%s]\nbut got:\n[%s]", expected, got)
+	}
+
+	w.Reset()
+	client.Increment("my_metric")
+	client.Flush(-1)
+
+	if expected, got := "my_metric:1|c|#env:dev,version:2", w.String(); expected != got {
+		t.Fatalf("expected [%s] but got [%s]", expected, got)
+	}
+
+	if calls != 2 {
+		t.Fatalf("expected the tags function to be called once per flush window but it was called %d times", calls)
+	}
+}
+
+func TestClientTagsNewline(t *testing.T) {
+	w := new(bytes.Buffer)
+	global := []string{"env:dev\nevil:1|c"}
+	client := NewClientWriter(w, "", WithGlobalTags(global...), WithDynamicTags(func() []string {
+		return []string{"pod:a\n"}
+	}))
+	client.IncrementTags("my_metric", "status:200\n")
+	client.Close()
+
+	if expected, got := "my_metric:1|c|#env:dev_evil:1|c,pod:a_,status:200_", w.String(); expected != got {
+		t.Fatalf("expected:\n[%s]\nbut got:\n[%s]", expected, got)
+	}
+
+	if global[0] != "env:dev\nevil:1|c" {
+		t.Fatalf("expected the caller's tags to be kept but got %q", global)
+	}
+
+	client = NewClientWriter(w, "", WithStrict())
+	defer client.Close()
+
+	if err := client.IncrementTags("my_metric", "status:200\n"); err != ErrNewline {
+		t.Fatalf("expected ErrNewline but got %v", err)
+	}
+
+	if got := client.Format("my_metric", "1", Count, 1); got != "my_metric:1|c" {
+		t.Fatalf("expected the metric to be formatted but got [%s]", got)
+	}
+}
+
+func TestClientEnvTags(t *testing.T) {
+	os.Setenv("STATSD_TEST_POD_NAME", "my-pod")
+	os.Setenv("STATSD_TEST_POD_NAMESPACE", "default")
+	defer os.Unsetenv("STATSD_TEST_POD_NAME")
+	defer os.Unsetenv("STATSD_TEST_POD_NAMESPACE")
+
+	w := new(bytes.Buffer)
+	client := NewClientWriter(w, "", WithEnvTags(map[string]string{
+		"STATSD_TEST_POD_NAME":      "pod",
+		"STATSD_TEST_POD_NAMESPACE": "namespace",
+		"STATSD_TEST_NODE_NAME":     "node", // unset.
+	}))
+	client.Increment("my_metric")
+	client.Close()
+
+	if expected, got := "my_metric:1|c|#pod:my-pod,namespace:default", w.String(); expected != got {
+		t.Fatalf("expected [%s] but got [%s]", expected, got)
+	}
+}
+
+func TestClientTaggedShortcuts(t *testing.T) {
+	tests := []struct {
+		write    func(c *Client) error
+		expected string
+	}{
+		{func(c *Client) error { return c.CountTags("my_count", 5, "env:dev") }, "my_count:5|c|#env:dev"},
+		{func(c *Client) error { return c.IncrementTags("my_count", "env:dev") }, "my_count:1|c|#env:dev"},
+		{func(c *Client) error { return c.GaugeTags("my_gauge", 10, "env:dev") }, "my_gauge:10|g|#env:dev"},
+		{func(c *Client) error { return c.TimeTags("my_timer", 2*time.Second, "env:dev") }, "my_timer:2000|ms|#env:dev"},
+	}
+
+	for i, tt := range tests {
+		w := new(bytes.Buffer)
+		client := NewClientWriter(w, "")
+		if err := tt.write(client); err != nil {
+			t.Fatal(err)
+		}
+		client.Close()
+
+		if got := w.String(); tt.expected != got {
+			t.Fatalf("[%d] expected [%s] but got [%s]", i, tt.expected, got)
+		}
+	}
+}
+
+func TestClientGaugeWithUnit(t *testing.T) {
+	w := new(bytes.Buffer)
+	client := NewClientWriter(w, "", WithFraming(FramingStream))
+	client.GaugeWithUnit("my_gauge", 10, "ms")
+	client.GaugeWithUnit("my_gauge", 10, "")
+	client.Close()
+
+	client = NewClientWriter(w, "", WithTagStyle(TagStyleGraphite))
+	client.GaugeWithUnit("my_gauge", 10, "bytes")
+	client.Close()
+
+	if expected, got := "my_gauge:10|g|#unit:ms\nmy_gauge:10|g\nmy_gauge;unit=bytes:10|g", w.String(); expected != got {
+		t.Fatalf("expected:\n[%s]\nbut got:\n[%s]", expected, got)
+	}
+}
+
+func TestClientTimeWithPercentiles(t *testing.T) {
+	w := new(bytes.Buffer)
+	client := NewClientWriter(w, "my_prefix.", WithFraming(FramingStream))
+	client.TimeWithPercentiles("my_timer", time.Second, 50, 90, 99)
+	client.TimeWithPercentiles("my_timer", time.Second)
+	client.Close()
+
+	expected := "my_prefix.my_timer:1000|ms\nmy_prefix.my_timer.percentiles:1|g|#percentiles:50_90_99\nmy_prefix.my_timer:1000|ms\n"
+	if got := w.String(); expected != got {
+		t.Fatalf("expected:\n[%s]\nbut got:\n[%s]", expected, got)
+	}
+}
@@ -0,0 +1,48 @@
+package statsd
+
+import "time"
+
+// Timer records the phases of a multi-phase operation as Timing metrics.
+// The metric names are composed by the timer's name, a dot and the phase's name.
+//
+// Example:
+// t := NewTimer(client, "request")
+// t.Start()
+// [query the database...]
+// t.Lap("db") // writes "request.db", the duration since `Start`.
+// [render the template...]
+// t.Lap("render") // writes "request.render", the duration since the previous `Lap`.
+// t.Stop() // writes "request.total", the duration since `Start`.
+type Timer struct {
+	client *Client
+	name   string
+
+	start time.Time
+	lap   time.Time
+}
+
+// NewTimer returns a new `Timer` which writes its metrics through the "client".
+// Call its `Start` to start timing.
+func NewTimer(client *Client, name string) *Timer {
+	return &Timer{client: client, name: name}
+}
+
+// Start starts (or restarts) the timer.
+func (t *Timer) Start() {
+	t.start = t.client.now()
+	t.lap = t.start
+}
+
+// Lap writes a Timing metric of "name.suffix" with the duration since the previous `Lap` or `Start`.
+func (t *Timer) Lap(suffix string) error {
+	now := t.client.now()
+	dur := now.Sub(t.lap)
+	t.lap = now
+
+	return t.client.Time(t.name+"."+suffix, dur)
+}
+
+// Stop writes a Timing metric of "name.total" with the duration since `Start`.
+func (t *Timer) Stop() error {
+	return t.client.Time(t.name+".total", t.client.now().Sub(t.start))
+}
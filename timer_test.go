@@ -0,0 +1,38 @@
+package statsd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimer(t *testing.T) {
+	w := &ClosingBuffer{new(bytes.Buffer)}
+	client := NewClient(w, "")
+	defer client.Close()
+
+	timer := NewTimer(client, "request")
+	timer.Start()
+	time.Sleep(20 * time.Millisecond)
+	timer.Lap("db")
+	time.Sleep(10 * time.Millisecond)
+	timer.Lap("render")
+	timer.Stop()
+	client.Flush(-1)
+
+	lines := strings.Split(w.String(), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 metrics but got [%s]", w.String())
+	}
+
+	for i, name := range []string{"request.db:", "request.render:", "request.total:"} {
+		if !strings.HasPrefix(lines[i], name) || !strings.HasSuffix(lines[i], "|ms") {
+			t.Fatalf("[%d] expected a timing metric of [%s] but got [%s]", i, name, lines[i])
+		}
+	}
+
+	if got := lines[2]; got == "request.total:0|ms" {
+		t.Fatalf("expected total to include all laps but got [%s]", got)
+	}
+}